@@ -0,0 +1,174 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/google/uuid"
+	"kafka/consumer"
+	"kafka/producer"
+	"kafka/security"
+)
+
+// Client owns a single sarama.Client and hands out producers and consumers built from it
+type Client struct {
+	client    sarama.Client
+	batchSize int
+
+	mu        sync.Mutex
+	producers []*producer.KafkaProducer
+	workers   []*consumer.Worker
+}
+
+// New creates a Client, the connection pool is opened immediately
+func New(opts ...Option) (*Client, error) {
+	o := newOptions(opts...)
+
+	cl, err := newSaramaClient(o)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		client:    cl,
+		batchSize: o.workerBatchSize,
+	}, nil
+}
+
+// Producer returns a producer writing to the topic through the shared sarama.Client
+func (c *Client) Producer(topic string, opts ...producer.Option) (*producer.KafkaProducer, error) {
+	p, err := producer.NewFromClient(c.client, topic, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.producers = append(c.producers, p)
+	c.mu.Unlock()
+	return p, nil
+}
+
+// Consumer returns a worker consuming through the shared sarama.Client, WorkerBatchSize of the client
+// is the default batch size of the worker
+func (c *Client) Consumer(opts ...consumer.Option) *consumer.Worker {
+	opts = append([]consumer.Option{consumer.WorkerBatchSize(c.batchSize)}, opts...)
+	w := consumer.New(append(opts, consumer.Client(c.client))...)
+
+	c.mu.Lock()
+	c.workers = append(c.workers, w)
+	c.mu.Unlock()
+	return w
+}
+
+// Sarama exposes the underlying sarama.Client
+func (c *Client) Sarama() sarama.Client {
+	return c.client
+}
+
+// Close stops the workers and flushes the producers handed out by the Client, then closes the shared client
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var firstErr error
+	for _, w := range c.workers {
+		if err := w.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	for _, p := range c.producers {
+		if err := p.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	c.workers, c.producers = nil, nil
+
+	if err := c.client.Close(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
+
+// NewKafkaClient returns a raw sarama.Client, use New to get the Client facade
+func NewKafkaClient(
+	opts ...Option,
+) (sarama.Client, error) {
+	return newSaramaClient(newOptions(opts...))
+}
+
+func newOptions(opts ...Option) *options {
+	o := &options{
+		service:                      "golang_service",
+		workerHeartBeatInterval:      time.Second * 3,
+		workerBatchSize:              100000,
+		workerMaxProcessingTime:      time.Millisecond * 100,
+		workerConsumerSessionTimeout: time.Second * 10,
+		kafkaVersion:                 "3.2.0",
+		consumeReturnError:           true,
+		initialOffset:                sarama.OffsetOldest,
+		brokers:                      []string{"localhost"},
+		sessionId:                    uuid.New().String(),
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// NewConfig returns the sarama config NewKafkaClient connects with
+func NewConfig(opts ...Option) (*sarama.Config, error) {
+	return newConfig(newOptions(opts...))
+}
+
+func newSaramaClient(o *options) (sarama.Client, error) {
+	cfg, err := newConfig(o)
+	if err != nil {
+		return nil, err
+	}
+
+	kafkaClient, err := sarama.NewClient(o.brokers, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("[kafka] could not create a client: %w", err)
+	}
+	return kafkaClient, nil
+}
+
+func newConfig(o *options) (*sarama.Config, error) {
+	cfg := sarama.NewConfig()
+	cfg.ClientID = makeClientID(o.service, o.sessionId)
+
+	version, err := sarama.ParseKafkaVersion(o.kafkaVersion)
+	if err != nil {
+		return nil, fmt.Errorf("[kafka] could not parse a version")
+	}
+	cfg.Version = version
+
+	if o.workerConsumerSessionTimeout > 0 {
+		cfg.Consumer.Group.Session.Timeout = o.workerConsumerSessionTimeout
+	}
+
+	// Heartbeats are used to ensure that the consumer's session stays active and
+	// to facilitate re-balancing when new consumers join or leave the group.
+	if o.workerHeartBeatInterval > 0 {
+		cfg.Consumer.Group.Heartbeat.Interval = o.workerHeartBeatInterval
+	}
+	if o.workerMaxProcessingTime > 0 {
+		cfg.Consumer.MaxProcessingTime = o.workerMaxProcessingTime
+	}
+	cfg.Consumer.Return.Errors = o.consumeReturnError
+	cfg.Consumer.Offsets.Initial = o.initialOffset
+
+	if err := security.Apply(cfg, o.tls, o.sasl); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func makeClientID(service, sessionId string) string {
+	hostname, _ := os.Hostname()
+	return service + "_" + hostname + "_" + sessionId
+}
@@ -0,0 +1,141 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"kafka/producer"
+	"kafka/security"
+	"kafka/security/securitytest"
+)
+
+// mockVersion keeps the client from sending ApiVersions requests, the mock broker doesn't answer them
+const mockVersion = "2.1.0"
+
+func TestTLS(t *testing.T) {
+	files := securitytest.NewFiles(t)
+	broker := sarama.NewMockBrokerListener(t, 1, securitytest.Listener(t, files))
+	defer broker.Close()
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("events", 0, broker.BrokerID()),
+		"ProduceRequest": sarama.NewMockProduceResponse(t).SetVersion(3),
+	})
+
+	cl, err := New(
+		KafkaBrokers(broker.Addr()),
+		KafkaVersion(mockVersion),
+		TLS(security.TLS{CAFile: files.CA, CertFile: files.ClientCert, KeyFile: files.ClientKey}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+
+	cfg := cl.Sarama().Config()
+	if !cfg.Net.TLS.Enable || cfg.Net.TLS.Config == nil {
+		t.Fatal("TLS is not enabled on the client")
+	}
+	if _, err := cl.Sarama().Partitions("events"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the producer connects through the client's TLS connections
+	p, err := cl.Producer("events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.SendSync(context.Background(), "key", "value"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTLSUntrusted(t *testing.T) {
+	files, other := securitytest.NewFiles(t), securitytest.NewFiles(t)
+	broker := sarama.NewMockBrokerListener(t, 1, securitytest.Listener(t, files))
+	defer broker.Close()
+
+	cfg, err := NewConfig(KafkaVersion(mockVersion), TLS(security.TLS{CAFile: other.CA, CertFile: files.ClientCert, KeyFile: files.ClientKey}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Metadata.Retry.Max = 0
+	if cl, err := sarama.NewClient([]string{broker.Addr()}, cfg); err == nil {
+		cl.Close()
+		t.Fatal("connected to a broker signed by an unknown CA")
+	}
+}
+
+func TestSASL(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"SaslHandshakeRequest":    sarama.NewMockSaslHandshakeResponse(t).SetEnabledMechanisms([]string{sarama.SASLTypePlaintext}),
+		"SaslAuthenticateRequest": sarama.NewMockSaslAuthenticateResponse(t),
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("events", 0, broker.BrokerID()),
+	})
+
+	cfg, err := NewConfig(KafkaVersion(mockVersion), SASL(security.SASL{Mechanism: security.Plain, User: "user", Password: "secret"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Net.SASL.Enable || cfg.Net.SASL.User != "user" || cfg.Net.SASL.Mechanism != sarama.SASLTypePlaintext {
+		t.Fatalf("SASL is not applied: %+v", cfg.Net.SASL)
+	}
+	// the mock broker speaks SaslAuthenticate only
+	cfg.Net.SASL.Version = sarama.SASLHandshakeV1
+
+	cl, err := sarama.NewClient([]string{broker.Addr()}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	if _, err := cl.Partitions("events"); err != nil {
+		t.Fatal(err)
+	}
+
+	var authenticated bool
+	for _, req := range broker.History() {
+		if _, ok := req.Request.(*sarama.SaslAuthenticateRequest); ok {
+			authenticated = true
+		}
+	}
+	if !authenticated {
+		t.Fatal("the client didn't authenticate")
+	}
+}
+
+func TestProducerRejectsConnectionOptions(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).SetBroker(broker.Addr(), broker.BrokerID()),
+	})
+
+	cl, err := New(KafkaBrokers(broker.Addr()), KafkaVersion(mockVersion))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	before := cl.Sarama().Config().Net.MaxOpenRequests
+
+	for name, opt := range map[string]producer.Option{
+		"TLS":                producer.TLS(security.TLS{}),
+		"SASL":               producer.SASL(security.SASL{User: "user"}),
+		"KafkaVersion":       producer.KafkaVersion(sarama.V2_0_0_0),
+		"Config":             producer.Config(sarama.NewConfig()),
+		"SaramaConfigurator": producer.SaramaConfigurator(func(*sarama.Config) {}),
+		"Idempotent":         producer.Idempotent(),
+	} {
+		if _, err := cl.Producer("events", opt); err == nil {
+			t.Errorf("%s is accepted", name)
+		}
+	}
+	if cfg := cl.Sarama().Config(); cfg.Net.MaxOpenRequests != before || cfg.Version != sarama.V2_1_0_0 {
+		t.Fatalf("client config is changed: MaxOpenRequests=%d Version=%s", cfg.Net.MaxOpenRequests, cfg.Version)
+	}
+}
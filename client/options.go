@@ -1,6 +1,10 @@
-package main
+package client
 
-import "time"
+import (
+	"time"
+
+	"kafka/security"
+)
 
 type Option func(*options)
 
@@ -12,8 +16,11 @@ type options struct {
 	workerConsumerSessionTimeout time.Duration
 	kafkaVersion                 string
 	consumeReturnError           bool
+	initialOffset                int64
 	brokers                      []string
 	sessionId                    string
+	tls                          *security.TLS
+	sasl                         *security.SASL
 }
 
 func SessionId(sessionId string) Option {
@@ -34,6 +41,7 @@ func WorkerHeartBeatInterval(interval time.Duration) Option {
 	}
 }
 
+// WorkerBatchSize is the default batch size of the consumers created by Client.Consumer
 func WorkerBatchSize(batchSize int) Option {
 	return func(o *options) {
 		o.workerBatchSize = batchSize
@@ -64,8 +72,30 @@ func ConsumeReturnError(isReturn bool) Option {
 	}
 }
 
+// InitialOffset is where a consumer group starts if it has no committed offset, sarama.OffsetOldest (default)
+// or sarama.OffsetNewest
+func InitialOffset(offset int64) Option {
+	return func(o *options) {
+		o.initialOffset = offset
+	}
+}
+
 func KafkaBrokers(brokers ...string) Option {
 	return func(o *options) {
 		o.brokers = brokers
 	}
 }
+
+// TLS enables TLS for broker connections
+func TLS(t security.TLS) Option {
+	return func(o *options) {
+		o.tls = &t
+	}
+}
+
+// SASL enables SASL authentication, PLAIN and SCRAM-SHA-256/512 are supported
+func SASL(s security.SASL) Option {
+	return func(o *options) {
+		o.sasl = &s
+	}
+}
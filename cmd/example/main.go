@@ -8,6 +8,7 @@ import (
 
 	"github.com/Shopify/sarama"
 	"github.com/google/uuid"
+	"kafka/client"
 	"kafka/consumer"
 	"kafka/producer"
 )
@@ -21,6 +22,7 @@ type Payload struct {
 
 type Event struct {
 	Payload Payload
+	Headers map[string]string
 	// kafka info
 	KafkaTopic     string
 	KafkaOffSet    int64
@@ -43,6 +45,7 @@ func msgToEvent(msg *sarama.ConsumerMessage) (consumer.KafkaMsg, error) {
 		return Event{}, err
 	}
 	message.Payload = payload
+	message.Headers = consumer.Headers(msg)
 	message.KafkaPartition = msg.Partition
 	message.KafkaTopic = msg.Topic
 	message.KafkaOffSet = msg.Offset
@@ -63,9 +66,20 @@ func main() {
 		KafkaPartition: 0,
 	}
 
+	cl, err := client.New(
+		client.SessionId(uuid.New().String()),
+		client.KafkaVersion("3.2.0"),
+		client.Service("test_service"),
+		client.WorkerHeartBeatInterval(time.Second*2),
+		client.KafkaBrokers("localhost:9092"),
+	)
+	if err != nil {
+		fmt.Printf("failed to create client: %v\n", err)
+		return
+	}
+	defer cl.Close()
 
-	p, err := producer.NewKafkaProducer(
-		[]string{"localhost:9092"},
+	p, err := cl.Producer(
 		"producer-category-table-testing",
 		producer.SuccessHandler(func(msg *sarama.ProducerMessage) {
 			fmt.Printf("Successfully sent message to topic:%s , partition:%d , value: %v\n", msg.Topic, msg.Partition, msg.Value)
@@ -78,28 +92,20 @@ func main() {
 		return
 	}
 
-	err = p.Send("", toKafka)
+	ctx := context.Background()
+	err = p.Send(ctx, "", toKafka, producer.Header("content-type", "application/json"))
 	if err != nil {
-		fmt.Printf("failed to send msg : %w", err)
+		fmt.Printf("failed to send msg : %v\n", err)
 		return
 	}
 
 	dest := make(chan *consumer.KafkaMsg)
-	ctx := context.Background()
-	cl, err := NewKafkaClient(
-		SessionId(uuid.New().String()),
-		KafkaVersion("3.2.0"),
-		Service("test_service"),
-		WorkerHeartBeatInterval(time.Second*2),
-		KafkaBrokers("localhost:9092"),
-	)
 
-	cons := consumer.New(
+	cons := cl.Consumer(
 		consumer.ReadSince(time.Now().AddDate(0, 0, -1)),
 		consumer.KeepOffset(false),
 		consumer.Context(context.Background()),
 		consumer.LoggerSet(nil),
-		consumer.Client(cl),
 		consumer.Topics([]string{"producer-category-table-testing"}),
 		consumer.Group("test"),
 		consumer.DestinationChan(dest),
@@ -0,0 +1,89 @@
+// Command lagexporter serves the lag of consumer groups as Prometheus metrics, see consumer.LagCollector.
+// Connection settings are read from KAFKA_* environment variables, or from -config
+//
+//	lagexporter -groups billing,billing.retry [-topics orders] [-addr :9308] [-interval 15s] [-config kafka.yaml]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"kafka/client"
+	"kafka/config"
+	"kafka/consumer"
+)
+
+func main() {
+	var (
+		groups   = flag.String("groups", "", "comma separated consumer groups")
+		topics   = flag.String("topics", "", "comma separated topics, all the committed ones by default")
+		addr     = flag.String("addr", ":9308", "address of the /metrics endpoint")
+		interval = flag.Duration("interval", 15*time.Second, "collection interval")
+		file     = flag.String("config", "", "yaml/json config file")
+	)
+	flag.Parse()
+	if *groups == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(*file, *addr, *interval, split(*groups), split(*topics)); err != nil {
+		fmt.Fprintf(os.Stderr, "lagexporter: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(file, addr string, interval time.Duration, groups, topics []string) error {
+	cfg, err := loadConfig(file)
+	if err != nil {
+		return err
+	}
+	cl, err := client.New(cfg.Client.Options()...)
+	if err != nil {
+		return err
+	}
+	defer cl.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	watched := make(map[string][]string, len(groups))
+	for _, group := range groups {
+		watched[group] = topics
+	}
+	go consumer.NewLagCollector(cl.Sarama(), watched, interval, nil).Run(ctx)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Shutdown(context.Background())
+	}()
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func split(list string) []string {
+	if list == "" {
+		return nil
+	}
+	return strings.Split(list, ",")
+}
+
+func loadConfig(file string) (*config.Config, error) {
+	if file != "" {
+		return config.Load(file)
+	}
+	return config.FromEnv()
+}
@@ -0,0 +1,80 @@
+// Command redrive republishes dead letters to their original topics, see consumer.Redrive.
+// Connection settings are read from KAFKA_* environment variables, or from -config
+//
+//	redrive -dlq orders.dlq [-group orders.dlq.redrive] [-source orders] [-config kafka.yaml]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/Shopify/sarama"
+	"kafka/client"
+	"kafka/config"
+	"kafka/consumer"
+)
+
+func main() {
+	var (
+		dlq    = flag.String("dlq", "", "dead letter topic")
+		group  = flag.String("group", "", "group keeping the progress, <dlq>.redrive by default")
+		source = flag.String("source", "", "redrive only dead letters of this topic")
+		file   = flag.String("config", "", "yaml/json config file")
+	)
+	flag.Parse()
+	if *dlq == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *group == "" {
+		*group = *dlq + ".redrive"
+	}
+
+	if err := run(*file, *dlq, *group, *source); err != nil {
+		fmt.Fprintf(os.Stderr, "redrive: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(file, dlq, group, source string) error {
+	cfg, err := loadConfig(file)
+	if err != nil {
+		return err
+	}
+	cl, err := client.New(cfg.Client.Options()...)
+	if err != nil {
+		return err
+	}
+	defer cl.Close()
+
+	p, err := cl.Producer("")
+	if err != nil {
+		return err
+	}
+
+	var filter func(*sarama.ConsumerMessage) bool
+	if source != "" {
+		filter = func(msg *sarama.ConsumerMessage) bool {
+			topic, _ := consumer.Header(msg, consumer.HeaderOriginalTopic)
+			return string(topic) == source
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	n, err := consumer.Redrive(ctx, cl.Sarama(), p, dlq, group, filter)
+	fmt.Printf("redriven %d messages from %s\n", n, dlq)
+	return err
+}
+
+func loadConfig(file string) (*config.Config, error) {
+	if file != "" {
+		return config.Load(file)
+	}
+	return config.FromEnv()
+}
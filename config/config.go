@@ -0,0 +1,131 @@
+// Package config loads client, producer and consumer settings from YAML/JSON files and KAFKA_* env variables
+// and converts them into the Option slices of the client, producer and consumer packages.
+package config
+
+import (
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	Client   ClientConfig   `yaml:"client"`
+	Producer ProducerConfig `yaml:"producer"`
+	Consumer ConsumerConfig `yaml:"consumer"`
+}
+
+type ClientConfig struct {
+	Brokers            []string      `yaml:"brokers" env:"KAFKA_BROKERS"`
+	Service            string        `yaml:"service" env:"KAFKA_SERVICE"`
+	SessionId          string        `yaml:"session_id" env:"KAFKA_SESSION_ID"`
+	KafkaVersion       string        `yaml:"kafka_version" env:"KAFKA_VERSION"`
+	HeartBeatInterval  time.Duration `yaml:"heartbeat_interval" env:"KAFKA_HEARTBEAT_INTERVAL"`
+	BatchSize          int           `yaml:"batch_size" env:"KAFKA_BATCH_SIZE"`
+	MaxProcessingTime  time.Duration `yaml:"max_processing_time" env:"KAFKA_MAX_PROCESSING_TIME"`
+	SessionTimeout     time.Duration `yaml:"session_timeout" env:"KAFKA_SESSION_TIMEOUT"`
+	ConsumeReturnError bool          `yaml:"consume_return_error" env:"KAFKA_CONSUME_RETURN_ERROR"`
+	// InitialOffset is "oldest" or "newest", where a group without committed offsets starts
+	InitialOffset string     `yaml:"initial_offset" env:"KAFKA_INITIAL_OFFSET"`
+	TLS           TLSConfig  `yaml:"tls"`
+	SASL          SASLConfig `yaml:"sasl"`
+}
+
+type TLSConfig struct {
+	Enable             bool   `yaml:"enable" env:"KAFKA_TLS_ENABLE"`
+	CAFile             string `yaml:"ca_file" env:"KAFKA_TLS_CA_FILE"`
+	CertFile           string `yaml:"cert_file" env:"KAFKA_TLS_CERT_FILE"`
+	KeyFile            string `yaml:"key_file" env:"KAFKA_TLS_KEY_FILE"`
+	ServerName         string `yaml:"server_name" env:"KAFKA_TLS_SERVER_NAME"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify" env:"KAFKA_TLS_INSECURE_SKIP_VERIFY"`
+}
+
+type SASLConfig struct {
+	Enable    bool   `yaml:"enable" env:"KAFKA_SASL_ENABLE"`
+	Mechanism string `yaml:"mechanism" env:"KAFKA_SASL_MECHANISM"`
+	User      string `yaml:"user" env:"KAFKA_SASL_USER"`
+	Password  string `yaml:"password" env:"KAFKA_SASL_PASSWORD"`
+}
+
+type ProducerConfig struct {
+	Topic            string        `yaml:"topic" env:"KAFKA_PRODUCER_TOPIC"`
+	FlushFrequency   time.Duration `yaml:"flush_frequency" env:"KAFKA_PRODUCER_FLUSH_FREQUENCY"`
+	FlushMessages    int           `yaml:"flush_messages" env:"KAFKA_PRODUCER_FLUSH_MESSAGES"`
+	Compression      string        `yaml:"compression" env:"KAFKA_PRODUCER_COMPRESSION"`
+	CompressionLevel int           `yaml:"compression_level" env:"KAFKA_PRODUCER_COMPRESSION_LEVEL"`
+	Retries          int           `yaml:"retries" env:"KAFKA_PRODUCER_RETRIES"`
+}
+
+type ConsumerConfig struct {
+	Topics     []string `yaml:"topics" env:"KAFKA_CONSUMER_TOPICS"`
+	Group      string   `yaml:"group" env:"KAFKA_CONSUMER_GROUP"`
+	BatchSize  int      `yaml:"batch_size" env:"KAFKA_CONSUMER_BATCH_SIZE"`
+	KeepOffset bool     `yaml:"keep_offset" env:"KAFKA_CONSUMER_KEEP_OFFSET"`
+	// ReadSince is a look-back window, partitions start at the first offset after now-ReadSince
+	ReadSince time.Duration `yaml:"read_since" env:"KAFKA_CONSUMER_READ_SINCE"`
+	// FilterByTime also skips messages by their payload time, see consumer.FilterByTime
+	FilterByTime bool `yaml:"filter_by_time" env:"KAFKA_CONSUMER_FILTER_BY_TIME"`
+	// RebalanceStrategy is range, roundrobin or sticky, sarama's default (range) is used if it's empty
+	RebalanceStrategy string `yaml:"rebalance_strategy" env:"KAFKA_CONSUMER_REBALANCE_STRATEGY"`
+}
+
+// Default returns the defaults of client.NewKafkaClient, producer.NewKafkaProducer and consumer.New
+func Default() *Config {
+	return &Config{
+		Client: ClientConfig{
+			Brokers:            []string{"localhost"},
+			Service:            "golang_service",
+			KafkaVersion:       "3.2.0",
+			HeartBeatInterval:  time.Second * 3,
+			BatchSize:          100000,
+			MaxProcessingTime:  time.Millisecond * 100,
+			SessionTimeout:     time.Second * 10,
+			ConsumeReturnError: true,
+			InitialOffset:      "oldest",
+		},
+		Producer: ProducerConfig{
+			FlushFrequency:   0,
+			FlushMessages:    0,
+			Compression:      "none",
+			CompressionLevel: -1000, // sarama.CompressionLevelDefault
+			Retries:          3,
+		},
+		Consumer: ConsumerConfig{
+			Topics:    []string{"producer-category-table-testing", "producer-image-table-testing", "producer-product-table-testing"},
+			BatchSize: 10000,
+			ReadSince: time.Hour * 60,
+		},
+	}
+}
+
+// Load reads the file (YAML or JSON), then applies KAFKA_* env variables on top and validates the result.
+// Empty path means env only
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "[kafka] can't read config file")
+		}
+		// JSON is a subset of YAML, so one decoder serves both
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, errors.Wrap(err, "[kafka] can't parse config file")
+		}
+	}
+
+	if err := applyEnv(cfg); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// FromEnv is Load without a file
+func FromEnv() (*Config, error) {
+	return Load("")
+}
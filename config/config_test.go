@@ -0,0 +1,146 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, name, data string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadYAML(t *testing.T) {
+	path := writeConfig(t, "kafka.yaml", `
+client:
+  brokers: [kafka-1:9092, kafka-2:9092]
+  kafka_version: 2.8.0
+  heartbeat_interval: 2s
+  session_timeout: 30s
+  sasl:
+    enable: true
+    mechanism: SCRAM-SHA-512
+    user: svc
+producer:
+  topic: events
+  flush_frequency: 250ms
+  compression: zstd
+consumer:
+  topics: [events]
+  group: billing
+  read_since: 90m
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"kafka-1:9092", "kafka-2:9092"}; !reflect.DeepEqual(cfg.Client.Brokers, want) {
+		t.Fatalf("brokers %v, want %v", cfg.Client.Brokers, want)
+	}
+	if cfg.Client.HeartBeatInterval != 2*time.Second || cfg.Client.SessionTimeout != 30*time.Second {
+		t.Fatalf("heartbeat %v, session timeout %v", cfg.Client.HeartBeatInterval, cfg.Client.SessionTimeout)
+	}
+	if cfg.Producer.FlushFrequency != 250*time.Millisecond || cfg.Consumer.ReadSince != 90*time.Minute {
+		t.Fatalf("flush frequency %v, read since %v", cfg.Producer.FlushFrequency, cfg.Consumer.ReadSince)
+	}
+	if !cfg.Client.SASL.Enable || cfg.Client.SASL.User != "svc" || cfg.Producer.Compression != "zstd" {
+		t.Fatalf("got %+v", cfg)
+	}
+	// not in the file
+	if cfg.Client.MaxProcessingTime != Default().Client.MaxProcessingTime || cfg.Producer.Retries != 3 {
+		t.Fatalf("defaults are lost: %+v", cfg)
+	}
+}
+
+func TestLoadJSON(t *testing.T) {
+	path := writeConfig(t, "kafka.json", `{
+		"client": {"brokers": ["kafka:9092"], "session_timeout": "1m"},
+		"producer": {"retries": 7},
+		"consumer": {"topics": ["orders", "payments"], "keep_offset": true, "read_since": "12h"}
+	}`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Client.SessionTimeout != time.Minute || cfg.Consumer.ReadSince != 12*time.Hour {
+		t.Fatalf("session timeout %v, read since %v", cfg.Client.SessionTimeout, cfg.Consumer.ReadSince)
+	}
+	if cfg.Producer.Retries != 7 || !cfg.Consumer.KeepOffset || len(cfg.Consumer.Topics) != 2 {
+		t.Fatalf("got %+v", cfg)
+	}
+}
+
+func TestLoadEnvOverridesFile(t *testing.T) {
+	path := writeConfig(t, "kafka.yaml", "producer:\n  retries: 7\nconsumer:\n  read_since: 1h\n")
+	t.Setenv("KAFKA_BROKERS", "kafka-1:9092, kafka-2:9092,")
+	t.Setenv("KAFKA_PRODUCER_RETRIES", "5")
+	t.Setenv("KAFKA_CONSUMER_READ_SINCE", "2h30m")
+	t.Setenv("KAFKA_CONSUMER_KEEP_OFFSET", "true")
+	t.Setenv("KAFKA_TLS_SERVER_NAME", "kafka.internal")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"kafka-1:9092", "kafka-2:9092"}; !reflect.DeepEqual(cfg.Client.Brokers, want) {
+		t.Fatalf("brokers %v, want %v", cfg.Client.Brokers, want)
+	}
+	if cfg.Producer.Retries != 5 || cfg.Consumer.ReadSince != 150*time.Minute {
+		t.Fatalf("retries %d, read since %v", cfg.Producer.Retries, cfg.Consumer.ReadSince)
+	}
+	if !cfg.Consumer.KeepOffset || cfg.Client.TLS.ServerName != "kafka.internal" {
+		t.Fatalf("got %+v", cfg)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("a missing file is accepted")
+	}
+	if _, err := Load(writeConfig(t, "kafka.yaml", "client: [")); err == nil {
+		t.Error("a broken file is accepted")
+	}
+	if _, err := Load(writeConfig(t, "kafka.yaml", "consumer:\n  read_since: soon\n")); err == nil {
+		t.Error("an invalid duration is accepted")
+	}
+
+	t.Setenv("KAFKA_PRODUCER_RETRIES", "many")
+	if _, err := FromEnv(); err == nil || !strings.Contains(err.Error(), "KAFKA_PRODUCER_RETRIES") {
+		t.Errorf("got %v, want the invalid variable", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for want, change := range map[string]func(c *Config){
+		"brokers are not set":           func(c *Config) { c.Client.Brokers = nil },
+		"invalid kafka_version":         func(c *Config) { c.Client.KafkaVersion = "latest" },
+		"timeouts must not be negative": func(c *Config) { c.Client.SessionTimeout = -time.Second },
+		"less than session_timeout":     func(c *Config) { c.Client.HeartBeatInterval = c.Client.SessionTimeout },
+		"initial_offset":                func(c *Config) { c.Client.InitialOffset = "latest" },
+		"cert_file and key_file":        func(c *Config) { c.Client.TLS.CertFile = "cert.pem" },
+		"sasl mechanism":                func(c *Config) { c.Client.SASL = SASLConfig{Enable: true, Mechanism: "GSSAPI", User: "svc"} },
+		"sasl user":                     func(c *Config) { c.Client.SASL = SASLConfig{Enable: true} },
+		"unsupported compression":       func(c *Config) { c.Producer.Compression = "brotli" },
+		"producer settings":             func(c *Config) { c.Producer.Retries = -1 },
+		"consumer topics":               func(c *Config) { c.Consumer.Topics = nil },
+		"consumer settings":             func(c *Config) { c.Consumer.ReadSince = -time.Hour },
+		"rebalance_strategy":            func(c *Config) { c.Consumer.RebalanceStrategy = "random" },
+	} {
+		cfg := Default()
+		change(cfg)
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("got %v, want %q", err, want)
+		}
+	}
+
+	if err := Default().Validate(); err != nil {
+		t.Fatalf("the defaults are invalid: %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"time"
+
+	"kafka/client"
+	"kafka/consumer"
+	"kafka/producer"
+	"kafka/security"
+)
+
+// Options converts the settings into client options
+func (c ClientConfig) Options() []client.Option {
+	opts := []client.Option{
+		client.KafkaBrokers(c.Brokers...),
+		client.Service(c.Service),
+		client.KafkaVersion(c.KafkaVersion),
+		client.WorkerHeartBeatInterval(c.HeartBeatInterval),
+		client.WorkerBatchSize(c.BatchSize),
+		client.WorkerMaxProcessingTime(c.MaxProcessingTime),
+		client.WorkerConsumerSessionTimeout(c.SessionTimeout),
+		client.ConsumeReturnError(c.ConsumeReturnError),
+		client.InitialOffset(initialOffsets[c.InitialOffset]),
+	}
+	// the client generates a session id if it's not set
+	if c.SessionId != "" {
+		opts = append(opts, client.SessionId(c.SessionId))
+	}
+	if t, ok := c.TLS.security(); ok {
+		opts = append(opts, client.TLS(t))
+	}
+	if s, ok := c.SASL.security(); ok {
+		opts = append(opts, client.SASL(s))
+	}
+	return opts
+}
+
+// ProducerOptions converts the settings into producer options, security settings are taken from the client section
+// as the producer connects to the same cluster. They are for NewKafkaProducer, a producer of a client.Client
+// takes Producer.Options() as the security settings are the client's
+func (c *Config) ProducerOptions() []producer.Option {
+	opts := c.Producer.Options()
+	if t, ok := c.Client.TLS.security(); ok {
+		opts = append(opts, producer.TLS(t))
+	}
+	if s, ok := c.Client.SASL.security(); ok {
+		opts = append(opts, producer.SASL(s))
+	}
+	return opts
+}
+
+// Options converts the settings into producer options
+func (c ProducerConfig) Options() []producer.Option {
+	return []producer.Option{
+		producer.FlushFrequency(c.FlushFrequency),
+		producer.FlushMessages(c.FlushMessages),
+		producer.Compression(compressionCodecs[c.Compression], c.CompressionLevel),
+		producer.ProducerRetries(c.Retries),
+	}
+}
+
+// Options converts the settings into consumer options, ReadSince is counted from now
+func (c ConsumerConfig) Options() []consumer.Option {
+	opts := []consumer.Option{
+		consumer.Topics(c.Topics),
+		consumer.Group(c.Group),
+		consumer.WorkerBatchSize(c.BatchSize),
+		consumer.KeepOffset(c.KeepOffset),
+		consumer.FilterByTime(c.FilterByTime),
+	}
+	if c.ReadSince > 0 {
+		opts = append(opts, consumer.ReadSince(time.Now().Add(-c.ReadSince)))
+	}
+	if strategy, ok := rebalanceStrategies[c.RebalanceStrategy]; ok {
+		opts = append(opts, consumer.RebalanceStrategy(strategy))
+	}
+	return opts
+}
+
+func (c TLSConfig) security() (security.TLS, bool) {
+	return security.TLS{
+		CAFile:             c.CAFile,
+		CertFile:           c.CertFile,
+		KeyFile:            c.KeyFile,
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}, c.Enable
+}
+
+func (c SASLConfig) security() (security.SASL, bool) {
+	return security.SASL{
+		Mechanism: security.Mechanism(c.Mechanism),
+		User:      c.User,
+		Password:  c.Password,
+	}, c.Enable
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"github.com/Shopify/sarama"
+	"github.com/pkg/errors"
+	"kafka/security"
+)
+
+var initialOffsets = map[string]int64{
+	"":       sarama.OffsetOldest,
+	"oldest": sarama.OffsetOldest,
+	"newest": sarama.OffsetNewest,
+}
+
+var rebalanceStrategies = map[string]sarama.BalanceStrategy{
+	"range":      sarama.BalanceStrategyRange,
+	"roundrobin": sarama.BalanceStrategyRoundRobin,
+	"sticky":     sarama.BalanceStrategySticky,
+}
+
+var compressionCodecs = map[string]sarama.CompressionCodec{
+	"":       sarama.CompressionNone,
+	"none":   sarama.CompressionNone,
+	"gzip":   sarama.CompressionGZIP,
+	"snappy": sarama.CompressionSnappy,
+	"lz4":    sarama.CompressionLZ4,
+	"zstd":   sarama.CompressionZSTD,
+}
+
+// Validate checks the values sarama would reject later, at connection time
+func (c *Config) Validate() error {
+	if err := c.Client.validate(); err != nil {
+		return err
+	}
+	if err := c.Producer.validate(); err != nil {
+		return err
+	}
+	return c.Consumer.validate()
+}
+
+func (c *ClientConfig) validate() error {
+	if len(c.Brokers) == 0 {
+		return errors.New("[kafka] brokers are not set")
+	}
+	if _, err := sarama.ParseKafkaVersion(c.KafkaVersion); err != nil {
+		return errors.Wrap(err, "[kafka] invalid kafka_version")
+	}
+	if c.HeartBeatInterval < 0 || c.MaxProcessingTime < 0 || c.SessionTimeout < 0 {
+		return errors.New("[kafka] timeouts must not be negative")
+	}
+	if c.HeartBeatInterval > 0 && c.SessionTimeout > 0 && c.HeartBeatInterval >= c.SessionTimeout {
+		return errors.New("[kafka] heartbeat_interval must be less than session_timeout")
+	}
+	if _, ok := initialOffsets[c.InitialOffset]; !ok {
+		return errors.Errorf("[kafka] initial_offset must be oldest or newest, got %q", c.InitialOffset)
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return errors.New("[kafka] tls cert_file and key_file must be set together")
+	}
+	if c.SASL.Enable {
+		switch security.Mechanism(c.SASL.Mechanism) {
+		case "", security.Plain, security.ScramSHA256, security.ScramSHA512:
+		default:
+			return errors.Errorf("[kafka] unsupported sasl mechanism %q", c.SASL.Mechanism)
+		}
+		if c.SASL.User == "" {
+			return errors.New("[kafka] sasl user is not set")
+		}
+	}
+	return nil
+}
+
+func (c *ProducerConfig) validate() error {
+	if _, ok := compressionCodecs[c.Compression]; !ok {
+		return errors.Errorf("[kafka] unsupported compression %q", c.Compression)
+	}
+	if c.FlushFrequency < 0 || c.FlushMessages < 0 || c.Retries < 0 {
+		return errors.New("[kafka] producer settings must not be negative")
+	}
+	return nil
+}
+
+func (c *ConsumerConfig) validate() error {
+	if len(c.Topics) == 0 {
+		return errors.New("[kafka] consumer topics are not set")
+	}
+	if c.BatchSize < 0 || c.ReadSince < 0 {
+		return errors.New("[kafka] consumer settings must not be negative")
+	}
+	if _, ok := rebalanceStrategies[c.RebalanceStrategy]; c.RebalanceStrategy != "" && !ok {
+		return errors.Errorf("[kafka] unsupported rebalance_strategy %q", c.RebalanceStrategy)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package consumer
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// consumeBatches collects messages of the claim until the batch size is reached or the linger time since
+// the first message of the batch elapses, then passes them to the batch handler or BatchChan
+func (h *consumerHandler) consumeBatches(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	ctx := session.Context()
+	tracker := newOffsetTracker(func(offset int64) {
+		h.mark(session, claim.Topic(), claim.Partition(), offset)
+	})
+
+	size := h.msgHandler.batchSize
+	if size < 1 {
+		size = 1
+	}
+	batch := make([]Message, 0, size)
+	var linger <-chan time.Time
+
+	flush := func() bool {
+		linger = nil
+		if len(batch) == 0 {
+			return true
+		}
+		msgs := batch
+		batch = make([]Message, 0, size)
+		return h.deliverBatch(ctx, tracker, msgs)
+	}
+
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				flush()
+				h.drain(tracker, claim)
+				return nil
+			}
+			if !h.msgHandler.waitDue(ctx, msg) {
+				return nil
+			}
+			countEvent(msg)
+			tracker.add(msg.Offset)
+
+			m := Message{ConsumerMessage: msg}
+			if err := h.msgHandler.build(&m); err != nil {
+				if h.msgHandler.buildFailed(ctx, m, err) {
+					tracker.finish(msg.Offset)
+					continue
+				}
+				// the session is over
+				return nil
+			}
+
+			batch = append(batch, m)
+			if len(batch) == 1 {
+				linger = time.After(h.msgHandler.linger)
+			}
+			if len(batch) >= size && !flush() {
+				return nil
+			}
+		case <-linger:
+			if !flush() {
+				return nil
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// deliverBatch returns false if the session is over before the batch is delivered or handled
+func (h *consumerHandler) deliverBatch(ctx context.Context, tracker *offsetTracker, msgs []Message) bool {
+	if h.msgHandler.batchHandler != nil {
+		if err := h.msgHandler.processBatch(ctx, msgs); err != nil {
+			return false
+		}
+		for _, m := range msgs {
+			tracker.finish(m.Offset)
+		}
+		return true
+	}
+
+	return h.sendBatch(ctx, tracker, msgs, h.msgHandler.backoff)
+}
+
+// sendBatch sends the batch to BatchChan, it returns false if the session is over first. Messages of a
+// nacked batch that OnFailure doesn't handle are delivered again as a batch after the backoff
+func (h *consumerHandler) sendBatch(ctx context.Context, tracker *offsetTracker, msgs []Message, backoff time.Duration) bool {
+	b := &Batch{Messages: msgs}
+	b.settle = func(err error) {
+		atomic.AddInt64(&h.msgHandler.unacked, -int64(len(msgs)))
+		left := msgs[:0:0]
+		for _, m := range msgs {
+			if err == nil || h.msgHandler.failed(ctx, m, err) {
+				tracker.finish(m.Offset)
+			} else {
+				left = append(left, m)
+			}
+		}
+		if len(left) == 0 {
+			return
+		}
+		go func() {
+			if h.msgHandler.sleep(ctx, &backoff) {
+				h.sendBatch(ctx, tracker, left, backoff)
+			}
+		}()
+	}
+
+	atomic.AddInt64(&h.msgHandler.unacked, int64(len(msgs)))
+	select {
+	case h.msgHandler.batches <- b:
+		return true
+	case <-ctx.Done():
+		atomic.AddInt64(&h.msgHandler.unacked, -int64(len(msgs)))
+		return false
+	}
+}
+
+// drain lets acks of delivered messages land before the final commit of the session
+func (h *consumerHandler) drain(tracker *offsetTracker, claim sarama.ConsumerGroupClaim) {
+	select {
+	case <-tracker.drained():
+	case <-time.After(drainTimeout):
+		h.logger.Warn().Msgf("[kafka] %d messages of %s/%d are not acked, they will be consumed again",
+			tracker.pending(), claim.Topic(), claim.Partition())
+	}
+}
@@ -0,0 +1,121 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+func TestBatchHandlerSize(t *testing.T) {
+	var mu sync.Mutex
+	var sizes []int
+	h := newTestHandler(&HandlerConfig{
+		BatchSize: 2,
+		Linger:    time.Minute,
+		BatchHandler: func(ctx context.Context, msgs []Message) error {
+			mu.Lock()
+			sizes = append(sizes, len(msgs))
+			mu.Unlock()
+			return nil
+		},
+	}, nil)
+	session := newTestSession(context.Background())
+
+	// the last batch is flushed when the claim ends
+	waitDone(t, consumeAsync(h, session, newTestClaim(5)))
+	if want := []int{2, 2, 1}; !reflect.DeepEqual(sizes, want) {
+		t.Fatalf("batch sizes %v, want %v", sizes, want)
+	}
+	if got := session.lastMarked(); got != 5 {
+		t.Fatalf("marked %d, want 5", got)
+	}
+}
+
+func TestBatchLinger(t *testing.T) {
+	batches := make(chan []Message, 1)
+	h := newTestHandler(&HandlerConfig{
+		BatchSize: 10,
+		Linger:    20 * time.Millisecond,
+		BatchHandler: func(ctx context.Context, msgs []Message) error {
+			batches <- msgs
+			return nil
+		},
+	}, nil)
+	claim := &testClaim{messages: make(chan *sarama.ConsumerMessage, 1)}
+	claim.messages <- testMessage(0)
+	done := consumeAsync(h, newTestSession(context.Background()), claim)
+	defer waitDone(t, done)
+	defer close(claim.messages)
+
+	select {
+	case msgs := <-batches:
+		if len(msgs) != 1 {
+			t.Fatalf("got %d messages, want 1", len(msgs))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the batch isn't flushed after the linger time")
+	}
+}
+
+func TestBatchChanNackRedelivers(t *testing.T) {
+	batches := make(chan *Batch, 4)
+	h := newTestHandler(&HandlerConfig{BatchSize: 3, Linger: time.Minute, Batches: batches}, nil)
+	session := newTestSession(context.Background())
+	done := consumeAsync(h, session, newTestClaim(3))
+
+	(<-batches).Nack(errors.New("broken"))
+	if got := session.lastMarked(); got != -1 {
+		t.Fatalf("marked %d after Nack", got)
+	}
+	select {
+	case batch := <-batches:
+		if len(batch.Messages) != 3 {
+			t.Fatalf("redelivered %d messages, want 3", len(batch.Messages))
+		}
+		batch.Ack()
+	case <-time.After(5 * time.Second):
+		t.Fatal("the nacked batch isn't delivered again")
+	}
+	waitDone(t, done)
+	if got := session.lastMarked(); got != 3 {
+		t.Fatalf("marked %d, want 3", got)
+	}
+}
+
+func TestBatchBuildErrorWithoutOnFailure(t *testing.T) {
+	builder := func(msg *sarama.ConsumerMessage) (KafkaMsg, error) {
+		if msg.Offset == 0 {
+			return nil, errors.New("can't build")
+		}
+		return testKafkaMsg{}, nil
+	}
+	batches := make(chan *Batch, 1)
+	h := newTestHandler(&HandlerConfig{BatchSize: 2, Linger: time.Minute, Batches: batches}, builder)
+	session := newTestSession(context.Background())
+	done := consumeAsync(h, session, newTestClaim(3))
+
+	select {
+	case batch := <-batches:
+		if len(batch.Messages) != 2 || batch.Messages[0].Offset != 1 {
+			t.Fatalf("got %d messages from offset %d, want 2 from 1", len(batch.Messages), batch.Messages[0].Offset)
+		}
+		batch.Ack()
+	case <-time.After(5 * time.Second):
+		t.Fatal("messages after the broken one aren't delivered")
+	}
+	waitDone(t, done)
+	if got := session.lastMarked(); got != 3 {
+		t.Fatalf("marked %d, want 3", got)
+	}
+}
+
+func TestBatchWithoutSettle(t *testing.T) {
+	batch := &Batch{Messages: []Message{{ConsumerMessage: testMessage(0)}}}
+	batch.Ack()
+	batch.Nack(errors.New("broken"))
+}
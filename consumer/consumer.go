@@ -1,17 +1,35 @@
 package consumer
 
 import (
+	"context"
+	"errors"
 	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// drainTimeout bounds waiting for acks when a claim ends
+const drainTimeout = time.Second * 5
+
 // consumerHandler represents Sarama consumer consumerHandler
 type consumerHandler struct {
 	msgHandler *msgHandler
+	client     sarama.Client
 	logger     logger
 	keepOffset bool
+	// positions moves claims to ReadSince and Worker.Seek offsets when a session starts
+	positions positions
+	// consumed keeps the positions of the claims if offsets aren't committed, see LagMetrics
+	consumed *consumedOffsets
+
+	onAssigned RebalanceHandler
+	onRevoked  RebalanceHandler
+	// concurrency is the number of goroutines handling a claim by key, see Concurrency
+	concurrency int
 }
 
 // newConsumerHandler returns new claim consumerHandler (claim = topic + partition)
@@ -21,18 +39,32 @@ type consumerHandler struct {
 //     go ConsumeClaim(sess, claim)
 //     }
 //  3. Cleanup(sess)
-func newConsumerHandler(msgHandler *msgHandler, offset bool, logger logger) *consumerHandler {
+func newConsumerHandler(msgHandler *msgHandler, client sarama.Client, offset bool, logger logger) *consumerHandler {
 	return &consumerHandler{
 		keepOffset: offset,
 		msgHandler: msgHandler,
+		client:     client,
 		logger:     logger,
 	}
 }
 
+// mark marks the offset of the next message to consume, it's committed with KeepOffset only
+func (h *consumerHandler) mark(session sarama.ConsumerGroupSession, topic string, partition int32, offset int64) {
+	if h.keepOffset {
+		session.MarkOffset(topic, partition, offset, "")
+	}
+	if h.consumed != nil {
+		h.consumed.set(topic, partition, offset)
+	}
+}
+
 // Setup is run at the beginning of a new session, before ConsumeClaim.
-// TODO prepare something in setup
-func (h *consumerHandler) Setup(sarama.ConsumerGroupSession) error {
+func (h *consumerHandler) Setup(session sarama.ConsumerGroupSession) error {
 	h.msgHandler.initQueue()
+	h.startSession(session)
+	if h.onAssigned != nil {
+		h.onAssigned(session, session.Claims())
+	}
 	return nil
 }
 
@@ -43,34 +75,156 @@ func (h *consumerHandler) ConsumeClaim(session sarama.ConsumerGroupSession, clai
 	// NOTE: Do not move the code below to a goroutine.
 	// The `ConsumeClaim` itself is called within a goroutine, see:
 	// https://github.com/Shopify/sarama/blob/master/consumer_group.go#L27-L29
+	if h.msgHandler.batchHandler != nil || h.msgHandler.batches != nil {
+		return h.consumeBatches(session, claim)
+	}
+	if h.msgHandler.handler != nil && h.concurrency > 1 {
+		return h.consumeParallel(session, claim)
+	}
+	if h.msgHandler.handler != nil {
+		return h.consumeWithHandler(session, claim)
+	}
+	if h.msgHandler.messages != nil {
+		return h.consumeWithAck(session, claim)
+	}
+
+	ctx := session.Context()
 	for msg := range claim.Messages() {
-		err := h.msgHandler.handle(msg)
-		if err != nil {
-			Instance().TotalErrors.With(prometheus.Labels{
-				"partition": strconv.Itoa(int(msg.Partition)),
-				"topic":     msg.Topic,
-				"error":     err.Error(),
-			}).Inc()
-			h.logger.Err(err).Msg("[kafka] failed to consume a claim")
+		if !h.msgHandler.waitDue(ctx, msg) {
+			return nil
+		}
+		err := h.msgHandler.handle(ctx, msg)
+		if ctx.Err() != nil {
+			// not delivered, the next session consumes it again
+			return nil
+		}
+		if err != nil && err != errSkip {
+			if h.msgHandler.onFailure == nil {
+				countError(msg, err)
+				h.logger.Err(err).Msg("[kafka] failed to consume a claim")
+			} else if !h.msgHandler.failedForGood(ctx, Message{ConsumerMessage: msg}, err) {
+				// the session is over, the message will be consumed again by the next one
+				return nil
+			}
+		}
+		countEvent(msg)
+
+		// committed as read, kafka keeps offset in its own state for consumer groups only
+		h.mark(session, msg.Topic, msg.Partition, msg.Offset+1)
+	}
+	return nil
+}
+
+// consumeWithHandler marks a message only after the handler processed it
+func (h *consumerHandler) consumeWithHandler(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for msg := range claim.Messages() {
+		if !h.msgHandler.waitDue(session.Context(), msg) {
+			return nil
+		}
+		if err := h.msgHandler.process(session.Context(), msg); err != nil {
+			// the session is over, the message will be consumed again by the next one
+			return nil
 		}
+		countEvent(msg)
+		h.mark(session, msg.Topic, msg.Partition, msg.Offset+1)
+	}
+	return nil
+}
 
-		Instance().TotalEvents.With(prometheus.Labels{
-			"topic":     msg.Topic,
-			"partition": strconv.Itoa(int(msg.Partition)),
-		}).Inc()
+// consumeWithAck delivers messages with Ack/Nack, the offset is marked up to the contiguous acked messages
+func (h *consumerHandler) consumeWithAck(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	ctx := session.Context()
+	tracker := newOffsetTracker(func(offset int64) {
+		h.mark(session, claim.Topic(), claim.Partition(), offset)
+	})
+
+	for msg := range claim.Messages() {
+		if !h.msgHandler.waitDue(ctx, msg) {
+			return nil
+		}
+		countEvent(msg)
+		tracker.add(msg.Offset)
 
-		// kafka keeps offset in its own state for consumer groups only
-		if h.keepOffset {
-			// committed as read
-			session.MarkMessage(msg, "")
+		m := Message{ConsumerMessage: msg}
+		if err := h.msgHandler.build(&m); err != nil {
+			if h.msgHandler.buildFailed(ctx, m, err) {
+				tracker.finish(msg.Offset)
+				continue
+			}
+			// the session is over
+			return nil
+		}
+		if !h.deliver(ctx, tracker, m, h.msgHandler.backoff) {
+			// not delivered, the next session consumes it again
+			return nil
 		}
 	}
+
+	h.drain(tracker, claim)
 	return nil
 }
 
+// deliver sends the message to MessageChan, it returns false if the session is over first. A Nack that
+// OnFailure doesn't handle delivers the message again after the backoff instead of stalling the partition
+func (h *consumerHandler) deliver(ctx context.Context, tracker *offsetTracker, msg Message, backoff time.Duration) bool {
+	m := msg
+	m.once = &sync.Once{}
+	m.settle = func(err error) {
+		atomic.AddInt64(&h.msgHandler.unacked, -1)
+		if err == nil || h.msgHandler.failed(ctx, m, err) {
+			tracker.finish(m.Offset)
+			return
+		}
+		go func() {
+			if h.msgHandler.sleep(ctx, &backoff) {
+				h.deliver(ctx, tracker, msg, backoff)
+			}
+		}()
+	}
+
+	atomic.AddInt64(&h.msgHandler.unacked, 1)
+	select {
+	case h.msgHandler.messages <- &m:
+		return true
+	case <-ctx.Done():
+		atomic.AddInt64(&h.msgHandler.unacked, -1)
+		return false
+	}
+}
+
+func countEvent(msg *sarama.ConsumerMessage) {
+	Instance().TotalEvents.With(prometheus.Labels{
+		"topic":     msg.Topic,
+		"partition": strconv.Itoa(int(msg.Partition)),
+	}).Inc()
+}
+
+func countError(msg *sarama.ConsumerMessage, err error) {
+	Instance().TotalErrors.With(prometheus.Labels{
+		"partition": strconv.Itoa(int(msg.Partition)),
+		"topic":     msg.Topic,
+		"error":     err.Error(),
+	}).Inc()
+}
+
+// countGroupError counts an error of the consumer group, topic and partition are empty if it's not about a partition
+func countGroupError(err error) {
+	labels := prometheus.Labels{"partition": "", "topic": "", "error": err.Error()}
+	var cerr *sarama.ConsumerError
+	if errors.As(err, &cerr) {
+		labels["partition"] = strconv.Itoa(int(cerr.Partition))
+		labels["topic"] = cerr.Topic
+	}
+	Instance().TotalErrors.With(labels).Inc()
+}
+
 // Cleanup runs at the end of a session, once all ConsumeClaim goroutines have exited
 // but before the offsets are committed for the very last time.
+// The queue outlives the session (rebalance starts a new one), it's closed by the Worker
 func (h *consumerHandler) Cleanup(session sarama.ConsumerGroupSession) error {
-	h.msgHandler.closeQueue()
+	h.endSession()
+	if h.onRevoked != nil {
+		h.onRevoked(session, session.Claims())
+	}
 	return nil
 }
@@ -0,0 +1,353 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/rs/zerolog"
+)
+
+var testLogger = zerolog.New(io.Discard)
+
+// testSession is a group session of one claim, marked offsets are recorded instead of committed
+type testSession struct {
+	ctx    context.Context
+	claims map[string][]int32
+
+	mu     sync.Mutex
+	marked []int64
+	resets []int64
+}
+
+func newTestSession(ctx context.Context) *testSession {
+	return &testSession{ctx: ctx, claims: map[string][]int32{"events": {0}}}
+}
+
+func (s *testSession) Claims() map[string][]int32 { return s.claims }
+func (s *testSession) MemberID() string           { return "member" }
+func (s *testSession) GenerationID() int32        { return 1 }
+func (s *testSession) Commit()                    {}
+func (s *testSession) Context() context.Context   { return s.ctx }
+
+func (s *testSession) MarkOffset(_ string, _ int32, offset int64, _ string) {
+	s.mu.Lock()
+	s.marked = append(s.marked, offset)
+	s.mu.Unlock()
+}
+
+func (s *testSession) ResetOffset(_ string, _ int32, offset int64, _ string) {
+	s.mu.Lock()
+	s.resets = append(s.resets, offset)
+	s.mu.Unlock()
+}
+
+func (s *testSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.MarkOffset(msg.Topic, msg.Partition, msg.Offset+1, metadata)
+}
+
+// lastMarked is the last marked offset, -1 if nothing is marked
+func (s *testSession) lastMarked() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.marked) == 0 {
+		return -1
+	}
+	return s.marked[len(s.marked)-1]
+}
+
+// testClaim is partition 0 of the events topic
+type testClaim struct {
+	messages chan *sarama.ConsumerMessage
+}
+
+// newTestClaim holds n messages with offsets from 0 and keys a, b, c in turn, the channel is closed
+// like at the end of a session
+func newTestClaim(n int) *testClaim {
+	claim := &testClaim{messages: make(chan *sarama.ConsumerMessage, n)}
+	for i := 0; i < n; i++ {
+		claim.messages <- testMessage(int64(i))
+	}
+	close(claim.messages)
+	return claim
+}
+
+func testMessage(offset int64) *sarama.ConsumerMessage {
+	return &sarama.ConsumerMessage{
+		Topic:     "events",
+		Offset:    offset,
+		Key:       []byte{byte('a' + offset%3)},
+		Value:     []byte("value"),
+		Timestamp: time.Now(),
+	}
+}
+
+type testKafkaMsg struct{}
+
+func (testKafkaMsg) Time() int64 { return time.Now().Unix() }
+
+func (c *testClaim) Topic() string                            { return "events" }
+func (c *testClaim) Partition() int32                         { return 0 }
+func (c *testClaim) InitialOffset() int64                     { return 0 }
+func (c *testClaim) HighWaterMarkOffset() int64               { return int64(cap(c.messages)) }
+func (c *testClaim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+
+// newTestBroker is a mock broker leading partition 0 of events, see serve
+func newTestBroker(t *testing.T) *sarama.MockBroker {
+	broker := sarama.NewMockBroker(t, 1)
+	t.Cleanup(broker.Close)
+	return broker
+}
+
+// serve sets the responses of the broker in addition to the metadata one
+func serve(t *testing.T, broker *sarama.MockBroker, responses map[string]sarama.MockResponse) {
+	handlers := map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("events", 0, broker.BrokerID()),
+	}
+	for name, response := range responses {
+		handlers[name] = response
+	}
+	broker.SetHandlerByMap(handlers)
+}
+
+// newTestClient connects to a new test broker with the responses
+func newTestClient(t *testing.T, responses map[string]sarama.MockResponse) sarama.Client {
+	t.Helper()
+	broker := newTestBroker(t)
+	serve(t, broker, responses)
+	return connectTestClient(t, broker)
+}
+
+func connectTestClient(t *testing.T, broker *sarama.MockBroker) sarama.Client {
+	t.Helper()
+	cfg := sarama.NewConfig()
+	cfg.Version = sarama.V2_1_0_0
+	client, err := sarama.NewClient([]string{broker.Addr()}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+func newTestHandler(conf *HandlerConfig, builder msgBuilder) *consumerHandler {
+	if conf.Attempts == 0 {
+		conf.Attempts = 1
+	}
+	if conf.Backoff == 0 {
+		conf.Backoff = time.Millisecond
+	}
+	return newConsumerHandler(newMsgHandler(nil, conf, &testLogger, builder), nil, true, &testLogger)
+}
+
+// consumeAsync runs ConsumeClaim, the returned channel is closed when it returns
+func consumeAsync(h *consumerHandler, session *testSession, claim sarama.ConsumerGroupClaim) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = h.ConsumeClaim(session, claim)
+	}()
+	return done
+}
+
+func waitDone(t *testing.T, done <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("ConsumeClaim didn't return")
+	}
+}
+
+func TestHandlerRetriesUntilSuccess(t *testing.T) {
+	var calls int32
+	h := newTestHandler(&HandlerConfig{
+		Attempts: 5,
+		Handler: func(ctx context.Context, msg Message) error {
+			if msg.Offset == 1 && atomic.AddInt32(&calls, 1) < 3 {
+				return errors.New("not yet")
+			}
+			return nil
+		},
+	}, nil)
+	session := newTestSession(context.Background())
+
+	waitDone(t, consumeAsync(h, session, newTestClaim(3)))
+	if calls != 3 {
+		t.Fatalf("offset 1 handled %d times, want 3", calls)
+	}
+	if got := session.lastMarked(); got != 3 {
+		t.Fatalf("marked %d, want 3", got)
+	}
+}
+
+func TestHandlerOnFailure(t *testing.T) {
+	var calls, failures int32
+	h := newTestHandler(&HandlerConfig{
+		Attempts: 2,
+		Handler: func(ctx context.Context, msg Message) error {
+			atomic.AddInt32(&calls, 1)
+			return errors.New("broken")
+		},
+		OnFailure: func(ctx context.Context, msg Message, err error) error {
+			atomic.AddInt32(&failures, 1)
+			return nil
+		},
+	}, nil)
+	session := newTestSession(context.Background())
+
+	waitDone(t, consumeAsync(h, session, newTestClaim(2)))
+	if calls != 4 || failures != 2 {
+		t.Fatalf("calls=%d failures=%d, want 4 and 2", calls, failures)
+	}
+	if got := session.lastMarked(); got != 2 {
+		t.Fatalf("marked %d, want 2", got)
+	}
+}
+
+func TestHandlerTimeout(t *testing.T) {
+	var timedOut int32
+	h := newTestHandler(&HandlerConfig{
+		Timeout: 10 * time.Millisecond,
+		Handler: func(ctx context.Context, msg Message) error {
+			<-ctx.Done()
+			atomic.AddInt32(&timedOut, 1)
+			return ctx.Err()
+		},
+		OnFailure: func(ctx context.Context, msg Message, err error) error {
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("OnFailure got %v", err)
+			}
+			return nil
+		},
+	}, nil)
+
+	waitDone(t, consumeAsync(h, newTestSession(context.Background()), newTestClaim(1)))
+	if timedOut != 1 {
+		t.Fatalf("handler timed out %d times, want 1", timedOut)
+	}
+}
+
+func TestHandlerStopsWithSession(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	h := newTestHandler(&HandlerConfig{
+		Handler: func(ctx context.Context, msg Message) error {
+			cancel()
+			return errors.New("broken")
+		},
+	}, nil)
+	session := newTestSession(ctx)
+
+	waitDone(t, consumeAsync(h, session, newTestClaim(3)))
+	if got := session.lastMarked(); got != -1 {
+		t.Fatalf("marked %d after the session ended", got)
+	}
+}
+
+func newAckHandler(conf *HandlerConfig, builder msgBuilder) (*consumerHandler, chan *Message) {
+	messages := make(chan *Message, 16)
+	conf.Messages = messages
+	return newTestHandler(conf, builder), messages
+}
+
+func TestAckMarksContiguousMessages(t *testing.T) {
+	h, messages := newAckHandler(&HandlerConfig{}, nil)
+	session := newTestSession(context.Background())
+	done := consumeAsync(h, session, newTestClaim(3))
+
+	received := []*Message{<-messages, <-messages, <-messages}
+	received[2].Ack()
+	received[1].Ack()
+	if got := session.lastMarked(); got != -1 {
+		t.Fatalf("marked %d before offset 0 is acked", got)
+	}
+	received[0].Ack()
+	received[0].Ack()
+	waitDone(t, done)
+	if got := session.lastMarked(); got != 3 {
+		t.Fatalf("marked %d, want 3", got)
+	}
+}
+
+func TestNackRedeliversWithoutOnFailure(t *testing.T) {
+	h, messages := newAckHandler(&HandlerConfig{}, nil)
+	session := newTestSession(context.Background())
+	done := consumeAsync(h, session, newTestClaim(2))
+
+	deliveries := map[int64]int{}
+	for deliveries[0] < 3 || deliveries[1] < 1 {
+		msg := <-messages
+		deliveries[msg.Offset]++
+		if msg.Offset == 0 && deliveries[0] < 3 {
+			msg.Nack(errors.New("broken"))
+			continue
+		}
+		msg.Ack()
+	}
+	waitDone(t, done)
+	if got := session.lastMarked(); got != 2 {
+		t.Fatalf("marked %d, want 2", got)
+	}
+}
+
+func TestNackOnFailure(t *testing.T) {
+	var failures int32
+	h, messages := newAckHandler(&HandlerConfig{
+		OnFailure: func(ctx context.Context, msg Message, err error) error {
+			atomic.AddInt32(&failures, 1)
+			return nil
+		},
+	}, nil)
+	session := newTestSession(context.Background())
+	done := consumeAsync(h, session, newTestClaim(2))
+
+	(<-messages).Nack(errors.New("broken"))
+	(<-messages).Ack()
+	waitDone(t, done)
+	if failures != 1 {
+		t.Fatalf("OnFailure called %d times, want 1", failures)
+	}
+	if got := session.lastMarked(); got != 2 {
+		t.Fatalf("marked %d, want 2", got)
+	}
+	select {
+	case msg := <-messages:
+		t.Fatalf("offset %d delivered again", msg.Offset)
+	default:
+	}
+}
+
+func TestAckBuildErrorWithoutOnFailure(t *testing.T) {
+	builder := func(msg *sarama.ConsumerMessage) (KafkaMsg, error) {
+		if msg.Offset == 0 {
+			return nil, errors.New("can't build")
+		}
+		return testKafkaMsg{}, nil
+	}
+	h, messages := newAckHandler(&HandlerConfig{}, builder)
+	session := newTestSession(context.Background())
+	done := consumeAsync(h, session, newTestClaim(3))
+
+	for _, want := range []int64{1, 2} {
+		select {
+		case msg := <-messages:
+			if msg.Offset != want || msg.Msg == nil {
+				t.Fatalf("got offset %d (built %v), want %d", msg.Offset, msg.Msg != nil, want)
+			}
+			msg.Ack()
+		case <-time.After(5 * time.Second):
+			t.Fatalf("offset %d isn't delivered", want)
+		}
+	}
+	waitDone(t, done)
+	if got := session.lastMarked(); got != 3 {
+		t.Fatalf("marked %d, want 3", got)
+	}
+}
@@ -0,0 +1,179 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"kafka/producer"
+)
+
+// Headers added to dead letters in addition to the ones of RetryTopics
+const (
+	HeaderGroup    = "kafka-group"
+	HeaderFailedAt = "kafka-failed-at"
+)
+
+// deadLetter republishes messages which failed for good to the DLQ topic
+type deadLetter struct {
+	producer *producer.TypedProducer[[]byte]
+	topic    string
+	group    string
+}
+
+func newDeadLetter(p *producer.KafkaProducer, topic string) *deadLetter {
+	return &deadLetter{producer: producer.NewTyped[[]byte](p, producer.BytesCodec{}), topic: topic}
+}
+
+// DeadLetter makes messages which failed all Retries attempts go to the topic, "" means <topic>.dlq.
+// Key, value and headers are kept, the error, original topic/partition/offset, group and failure time
+// are added as headers, see Redrive. OnFailure is not used, the producer is not closed by the worker
+func DeadLetter(p *producer.KafkaProducer, topic string) Option {
+	return func(o *options) {
+		o.dlq = newDeadLetter(p, topic)
+	}
+}
+
+// failed is the FailureHandler of DeadLetter, the offset is marked only after the broker acks the copy
+func (d *deadLetter) failed(ctx context.Context, m Message, err error) error {
+	return d.publish(ctx, m, err)
+}
+
+func (d *deadLetter) publish(ctx context.Context, m Message, err error, extra ...sarama.RecordHeader) error {
+	origin := headerString(m.ConsumerMessage, HeaderOriginalTopic)
+	if origin == "" {
+		origin = m.Topic
+	}
+	topic := d.topic
+	if topic == "" {
+		topic = origin + ".dlq"
+	}
+
+	headers := append(failureHeaders(m, err), extra...)
+	headers = append(headers,
+		recordHeader(HeaderGroup, d.group),
+		recordHeader(HeaderFailedAt, time.Now().UTC().Format(time.RFC3339Nano)),
+	)
+	if _, err := d.producer.SendSyncTo(ctx, topic, string(m.Key), m.Value, headers...); err != nil {
+		return fmt.Errorf("[kafka] can't publish dead letter to %s: %w", topic, err)
+	}
+	return nil
+}
+
+// Redrive republishes the dead letters of the DLQ topic to their original topics without the failure headers,
+// from the offsets committed by group (the oldest ones at the first run) up to the end of the partitions at the
+// time of the call. Messages for which filter returns false or without the original topic are skipped.
+// The progress is committed as group, so a next run continues after the last redriven message
+func Redrive(ctx context.Context, client sarama.Client, p *producer.KafkaProducer, dlq, group string, filter func(*sarama.ConsumerMessage) bool) (int, error) {
+	partitions, err := client.Partitions(dlq)
+	if err != nil {
+		return 0, fmt.Errorf("[kafka] can't get partitions of %s: %w", dlq, err)
+	}
+	offsets, err := sarama.NewOffsetManagerFromClient(group, client)
+	if err != nil {
+		return 0, fmt.Errorf("[kafka] can't manage offsets of group %s: %w", group, err)
+	}
+	defer offsets.Close()
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		return 0, fmt.Errorf("[kafka] can't create consumer: %w", err)
+	}
+	defer consumer.Close()
+
+	sender := producer.NewTyped[[]byte](p, producer.BytesCodec{})
+	total := 0
+	for _, partition := range partitions {
+		n, err := redrivePartition(ctx, client, consumer, offsets, sender, dlq, partition, filter)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func redrivePartition(ctx context.Context, client sarama.Client, consumer sarama.Consumer, offsets sarama.OffsetManager,
+	sender *producer.TypedProducer[[]byte], dlq string, partition int32, filter func(*sarama.ConsumerMessage) bool) (int, error) {
+	end, err := client.GetOffset(dlq, partition, sarama.OffsetNewest)
+	if err != nil {
+		return 0, fmt.Errorf("[kafka] can't get newest offset topic=%s partition=%d: %w", dlq, partition, err)
+	}
+	pom, err := offsets.ManagePartition(dlq, partition)
+	if err != nil {
+		return 0, fmt.Errorf("[kafka] can't manage offset topic=%s partition=%d: %w", dlq, partition, err)
+	}
+	defer pom.AsyncClose()
+	defer offsets.Commit()
+
+	start, _ := pom.NextOffset()
+	if start < 0 {
+		if start, err = client.GetOffset(dlq, partition, sarama.OffsetOldest); err != nil {
+			return 0, fmt.Errorf("[kafka] can't get oldest offset topic=%s partition=%d: %w", dlq, partition, err)
+		}
+	}
+	if start >= end {
+		return 0, nil
+	}
+	pc, err := consumer.ConsumePartition(dlq, partition, start)
+	if err != nil {
+		return 0, fmt.Errorf("[kafka] can't consume topic=%s partition=%d: %w", dlq, partition, err)
+	}
+	defer pc.AsyncClose()
+
+	// transaction markers and compacted records below end are never delivered, so the partition is also
+	// done once the consumer has seen end and nothing arrives for a whole tick (fetches wait MaxWaitTime)
+	ticker := time.NewTicker(2 * client.Config().Consumer.MaxWaitTime)
+	defer ticker.Stop()
+	idle := false
+
+	n := 0
+	for {
+		select {
+		case msg := <-pc.Messages():
+			idle = false
+			if target := headerString(msg, HeaderOriginalTopic); target != "" && (filter == nil || filter(msg)) {
+				if _, err := sender.SendSyncTo(ctx, target, string(msg.Key), msg.Value, redriveHeaders(msg)...); err != nil {
+					return n, fmt.Errorf("[kafka] can't redrive message to %s: %w", target, err)
+				}
+				n++
+			}
+			pom.MarkOffset(msg.Offset+1, "")
+			if msg.Offset+1 >= end {
+				return n, nil
+			}
+		case <-ticker.C:
+			if idle && pc.HighWaterMarkOffset() >= end {
+				return n, nil
+			}
+			idle = true
+		case err := <-pc.Errors():
+			return n, err
+		case <-ctx.Done():
+			return n, ctx.Err()
+		}
+	}
+}
+
+// failureHeaderKeys are dropped by Redrive, so a message failing again gets new ones
+var failureHeaderKeys = map[string]bool{
+	HeaderRetryAttempt:      true,
+	HeaderRetryDue:          true,
+	HeaderOriginalTopic:     true,
+	HeaderOriginalPartition: true,
+	HeaderOriginalOffset:    true,
+	HeaderError:             true,
+	HeaderGroup:             true,
+	HeaderFailedAt:          true,
+}
+
+func redriveHeaders(msg *sarama.ConsumerMessage) []sarama.RecordHeader {
+	headers := make([]sarama.RecordHeader, 0, len(msg.Headers))
+	for _, h := range msg.Headers {
+		if h == nil || failureHeaderKeys[string(h.Key)] {
+			continue
+		}
+		headers = append(headers, *h)
+	}
+	return headers
+}
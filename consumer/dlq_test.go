@@ -0,0 +1,104 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+func TestDeadLetter(t *testing.T) {
+	p, acked := newCapturingProducer(t, "events", "events.dlq", "failed")
+	ctx := context.Background()
+	msg := testMessage(4)
+	msg.Headers = []*sarama.RecordHeader{{Key: []byte("trace"), Value: []byte("t1")}}
+
+	for topic, want := range map[string]string{"": "events.dlq", "failed": "failed"} {
+		w := New(Topics([]string{"events"}), Group("billing"), LoggerSet(&testLogger), DeadLetter(p, topic))
+		if err := w.onFailure(ctx, Message{ConsumerMessage: msg}, errors.New("broken")); err != nil {
+			t.Fatal(err)
+		}
+		got := <-acked
+		if got.Topic != want {
+			t.Fatalf("dead letter went to %s, want %s", got.Topic, want)
+		}
+		headers := producedHeaders(got)
+		for key, value := range map[string]string{
+			"trace":              "t1",
+			HeaderError:          "broken",
+			HeaderGroup:          "billing",
+			HeaderOriginalTopic:  "events",
+			HeaderOriginalOffset: "4",
+		} {
+			if headers[key] != value {
+				t.Fatalf("header %s=%q, want %q", key, headers[key], value)
+			}
+		}
+		if _, err := time.Parse(time.RFC3339Nano, headers[HeaderFailedAt]); err != nil {
+			t.Fatalf("failed at %q: %v", headers[HeaderFailedAt], err)
+		}
+	}
+}
+
+// deadLetters is a fetch response of the dlq partition 0 with a dead letter at every offset of headers,
+// sarama's mock fetch responses have no headers
+func deadLetters(headers [][]*sarama.RecordHeader, highWaterMark int64) sarama.MockResponse {
+	fetch := &sarama.FetchResponse{Version: 10}
+	for offset := range headers {
+		fetch.AddRecord("dlq", 0, sarama.StringEncoder("key"), sarama.StringEncoder("value"), int64(offset))
+	}
+	block := fetch.GetBlock("dlq", 0)
+	block.HighWaterMarkOffset = highWaterMark
+	block.LastStableOffset = highWaterMark
+	for i, record := range block.RecordsSet[0].RecordBatch.Records {
+		record.Headers = headers[i]
+	}
+	return sarama.NewMockWrapper(fetch)
+}
+
+func TestRedrive(t *testing.T) {
+	failure := func(topic string) []*sarama.RecordHeader {
+		return []*sarama.RecordHeader{
+			{Key: []byte("trace"), Value: []byte("t1")},
+			{Key: []byte(HeaderOriginalTopic), Value: []byte(topic)},
+			{Key: []byte(HeaderError), Value: []byte("broken")},
+			{Key: []byte(HeaderGroup), Value: []byte("billing")},
+		}
+	}
+	broker := newTestBroker(t)
+	// offset 3 is a transaction marker, it is never delivered
+	serve(t, broker, map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("dlq", 0, broker.BrokerID()),
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).
+			SetOffset("dlq", 0, sarama.OffsetOldest, 0).
+			SetOffset("dlq", 0, sarama.OffsetNewest, 4),
+		"FindCoordinatorRequest": sarama.NewMockFindCoordinatorResponse(t).
+			SetCoordinator(sarama.CoordinatorGroup, "redrive", broker),
+		"OffsetFetchRequest": sarama.NewMockOffsetFetchResponse(t).
+			SetOffset("redrive", "dlq", 0, -1, "", sarama.ErrNoError),
+		"OffsetCommitRequest": sarama.NewMockOffsetCommitResponse(t),
+		"FetchRequest":        deadLetters([][]*sarama.RecordHeader{failure("orders"), nil, failure("skipped")}, 4),
+	})
+	client := connectTestClient(t, broker)
+	p, acked := newCapturingProducer(t, "orders", "skipped")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	filter := func(msg *sarama.ConsumerMessage) bool { return headerString(msg, HeaderOriginalTopic) != "skipped" }
+	n, err := Redrive(ctx, client, p, "dlq", "redrive", filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("redrove %d messages, want 1", n)
+	}
+	got := <-acked
+	headers := producedHeaders(got)
+	if got.Topic != "orders" || len(headers) != 1 || headers["trace"] != "t1" {
+		t.Fatalf("redrove to %s with headers %v", got.Topic, headers)
+	}
+}
@@ -0,0 +1,156 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/Shopify/sarama"
+)
+
+// consumerLoop consumes the topics until ctx is done, fatal errors are sent to errCh.
+// Close waits until the claims are finished
+type consumerLoop interface {
+	pauser
+	run(ctx context.Context, errCh chan<- error)
+	seek(topic string, partition int32, offset int64) error
+	// claimed returns the partitions consumed at the moment
+	claimed() map[string][]int32
+	Close() error
+}
+
+// groupConsumer consumes the topics as a member of a consumer group
+type groupConsumer struct {
+	group  sarama.ConsumerGroup
+	client sarama.Client
+	// own is the client of a group with its own settings, closed with the group, see groupClient
+	own     sarama.Client
+	topics  []string
+	handler *consumerHandler
+	logger  logger
+
+	mu sync.Mutex
+	// restart ends the current session, Consume joins the next one
+	restart context.CancelFunc
+}
+
+func newGroupConsumer(w *Worker, handler *consumerHandler) (*groupConsumer, error) {
+	client, own := w.client, sarama.Client(nil)
+	if !w.keepOffset || len(w.strategies) > 0 {
+		var err error
+		if own, err = groupClient(w.client, w.keepOffset, w.strategies); err != nil {
+			return nil, err
+		}
+		client = own
+	}
+	group, err := sarama.NewConsumerGroupFromClient(w.kafkaGroup, client)
+	if err != nil {
+		if own != nil {
+			own.Close()
+		}
+		return nil, err
+	}
+	return &groupConsumer{group: group, client: w.client, own: own, topics: w.topics, handler: handler, logger: w.logger}, nil
+}
+
+// groupClient connects a client with a copy of the shared config, so the settings of the group don't change
+// other users of the shared client. Without KeepOffset auto-commit is disabled, marking offsets only positions
+// the claims of a session (see startSession)
+func groupClient(client sarama.Client, keepOffset bool, strategies []sarama.BalanceStrategy) (sarama.Client, error) {
+	conf := *client.Config()
+	if !keepOffset {
+		conf.Consumer.Offsets.AutoCommit.Enable = false
+	}
+	if len(strategies) > 0 {
+		conf.Consumer.Group.Rebalance.GroupStrategies = strategies
+	}
+	addrs := make([]string, 0, len(client.Brokers()))
+	for _, b := range client.Brokers() {
+		addrs = append(addrs, b.Addr())
+	}
+	own, err := sarama.NewClient(addrs, &conf)
+	if err != nil {
+		return nil, fmt.Errorf("[kafka] can't connect group client: %w", err)
+	}
+	return own, nil
+}
+
+func (g *groupConsumer) run(ctx context.Context, errCh chan<- error) {
+	errs := g.group.Errors()
+	for {
+		select {
+		case err, ok := <-errs:
+			if !ok {
+				// closed by Close, a closed channel would always be ready
+				errs = nil
+				continue
+			}
+			g.logger.Err(err).Msg("[kafka] consumer error")
+			countGroupError(err)
+		default:
+			if ctx.Err() != nil {
+				return
+			}
+			// Consume returns on rebalance or restart, the loop joins the next session
+			sessionCtx, restart := context.WithCancel(ctx)
+			g.setRestart(restart)
+			err := g.group.Consume(sessionCtx, g.topics, g.handler)
+			restart()
+			if err != nil {
+				g.logger.Err(err).Msg("[kafka] error during Consuming")
+				select {
+				case errCh <- err:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}
+}
+
+// seek marks the offset when the next session starts and restarts the current one
+func (g *groupConsumer) seek(topic string, partition int32, offset int64) error {
+	if offset < 0 {
+		resolved, err := g.client.GetOffset(topic, partition, offset)
+		if err != nil {
+			return fmt.Errorf("[kafka] can't resolve offset topic=%s partition=%d: %w", topic, partition, err)
+		}
+		offset = resolved
+	}
+	if err := g.handler.requestSeek(topic, partition, offset); err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.restart != nil {
+		g.restart()
+	}
+	return nil
+}
+
+// claimed returns the claims of the current session, nil between sessions
+func (g *groupConsumer) claimed() map[string][]int32 {
+	return g.handler.claims()
+}
+
+func (g *groupConsumer) setRestart(restart context.CancelFunc) {
+	g.mu.Lock()
+	g.restart = restart
+	g.mu.Unlock()
+}
+
+func (g *groupConsumer) Pause(partitions map[string][]int32)  { g.group.Pause(partitions) }
+func (g *groupConsumer) Resume(partitions map[string][]int32) { g.group.Resume(partitions) }
+func (g *groupConsumer) PauseAll()                            { g.group.PauseAll() }
+func (g *groupConsumer) ResumeAll()                           { g.group.ResumeAll() }
+
+func (g *groupConsumer) Close() error {
+	err := g.group.Close()
+	if g.own != nil {
+		if cerr := g.own.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,138 @@
+package consumer
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// closedGroup is a consumer group after Close: Errors is closed and Consume fails at once
+type closedGroup struct {
+	errs chan error
+}
+
+func (g *closedGroup) Consume(context.Context, []string, sarama.ConsumerGroupHandler) error {
+	return sarama.ErrClosedConsumerGroup
+}
+func (g *closedGroup) Errors() <-chan error      { return g.errs }
+func (g *closedGroup) Close() error              { return nil }
+func (g *closedGroup) Pause(map[string][]int32)  {}
+func (g *closedGroup) Resume(map[string][]int32) {}
+func (g *closedGroup) PauseAll()                 {}
+func (g *closedGroup) ResumeAll()                {}
+
+func TestGroupRunReturnsAfterClose(t *testing.T) {
+	group := &closedGroup{errs: make(chan error)}
+	close(group.errs)
+	g := &groupConsumer{group: group, topics: []string{"events"}, logger: &testLogger}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		g.run(ctx, make(chan error))
+	}()
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("run doesn't return once Errors is closed")
+	}
+}
+
+func TestRebalanceHooksOfSession(t *testing.T) {
+	var assigned, revoked map[string][]int32
+	h := newTestHandler(&HandlerConfig{}, nil)
+	h.onAssigned = func(_ sarama.ConsumerGroupSession, claims map[string][]int32) { assigned = claims }
+	h.onRevoked = func(_ sarama.ConsumerGroupSession, claims map[string][]int32) { revoked = claims }
+	session := newTestSession(context.Background())
+
+	if err := h.Setup(session); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(assigned, session.claims) || revoked != nil {
+		t.Fatalf("after Setup assigned %v revoked %v", assigned, revoked)
+	}
+	if err := h.Cleanup(session); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(revoked, session.claims) {
+		t.Fatalf("after Cleanup revoked %v", revoked)
+	}
+}
+
+func TestRebalanceHooksStandalone(t *testing.T) {
+	var mu sync.Mutex
+	var assigned, revoked map[string][]int32
+	stop := make(chan struct{})
+	_, result := runWorker(t, stop,
+		Client(newFetchClient(t, 1)),
+		Topics([]string{"events"}),
+		StartOffset(sarama.OffsetOldest),
+		PartitionRefresh(0),
+		OnPartitionsAssigned(func(_ sarama.ConsumerGroupSession, claims map[string][]int32) {
+			mu.Lock()
+			assigned = claims
+			mu.Unlock()
+		}),
+		OnPartitionsRevoked(func(_ sarama.ConsumerGroupSession, claims map[string][]int32) {
+			mu.Lock()
+			revoked = claims
+			mu.Unlock()
+		}),
+		Handler(func(ctx context.Context, msg Message) error {
+			close(stop)
+			return nil
+		}),
+	)
+
+	waitRun(t, result)
+	want := map[string][]int32{"events": {0}}
+	if !reflect.DeepEqual(assigned, want) || !reflect.DeepEqual(revoked, want) {
+		t.Fatalf("assigned %v revoked %v, want %v", assigned, revoked, want)
+	}
+}
+
+func TestRebalanceStrategyKeepsSharedConfig(t *testing.T) {
+	client := newTestClient(t, nil)
+	w := New(Client(client), Group("billing"), KeepOffset(true), LoggerSet(&testLogger),
+		RebalanceStrategy(sarama.BalanceStrategySticky))
+
+	g, err := newGroupConsumer(w, newTestHandler(&HandlerConfig{}, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	if got := client.Config().Consumer.Group.Rebalance.GroupStrategies; len(got) != 1 || got[0].Name() != "range" {
+		t.Fatalf("shared client got strategies %v", got)
+	}
+	own := g.own.Config()
+	if got := own.Consumer.Group.Rebalance.GroupStrategies; len(got) != 1 || got[0].Name() != "sticky" {
+		t.Fatalf("group client got strategies %v", got)
+	}
+	if !own.Consumer.Offsets.AutoCommit.Enable {
+		t.Fatal("auto-commit is disabled with KeepOffset")
+	}
+}
+
+func TestGroupWithoutKeepOffsetDoesntCommit(t *testing.T) {
+	client := newTestClient(t, nil)
+	w := New(Client(client), Group("billing"), LoggerSet(&testLogger))
+
+	g, err := newGroupConsumer(w, newTestHandler(&HandlerConfig{}, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	if g.own.Config().Consumer.Offsets.AutoCommit.Enable {
+		t.Fatal("auto-commit is enabled without KeepOffset")
+	}
+	if !client.Config().Consumer.Offsets.AutoCommit.Enable {
+		t.Fatal("auto-commit of the shared client is disabled")
+	}
+}
@@ -0,0 +1,29 @@
+package consumer
+
+import (
+	"bytes"
+
+	"github.com/Shopify/sarama"
+)
+
+// Header returns the value of the first record header with the key, use it in BuilderFn
+func Header(msg *sarama.ConsumerMessage, key string) ([]byte, bool) {
+	k := []byte(key)
+	for _, h := range msg.Headers {
+		if h != nil && bytes.Equal(h.Key, k) {
+			return h.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Headers returns record headers as a map, the last value wins for duplicated keys
+func Headers(msg *sarama.ConsumerMessage) map[string]string {
+	headers := make(map[string]string, len(msg.Headers))
+	for _, h := range msg.Headers {
+		if h != nil {
+			headers[string(h.Key)] = string(h.Value)
+		}
+	}
+	return headers
+}
@@ -0,0 +1,309 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+)
+
+// lagSamples is the number of high-water marks kept per partition to estimate the lag in time
+const lagSamples = 60
+
+// Lag of a group on a partition
+type Lag struct {
+	Group     string
+	Topic     string
+	Partition int32
+	// Committed is the consumed position for a worker without KeepOffset, see LagMetrics
+	Committed     int64
+	HighWaterMark int64
+	// Messages is HighWaterMark - Committed
+	Messages int64
+	// Delay estimates how long ago the high-water mark was at Committed, -1 if it's unknown yet
+	Delay time.Duration
+}
+
+// LagCollector exports the lag of consumer groups as kafka_consumer_lag and kafka_consumer_lag_seconds,
+// the committed offsets are compared with the high-water marks. The time lag is interpolated from the
+// high-water marks of the previous collections, so it's known from the second one
+type LagCollector struct {
+	client   sarama.Client
+	groups   map[string][]string
+	interval time.Duration
+	logger   logger
+	// claims restricts the partitions to the ones consumed by a worker, see LagMetrics
+	claims func() map[string][]int32
+	// consumed replaces the committed offsets of a worker that doesn't commit
+	consumed *consumedOffsets
+
+	mu       sync.Mutex
+	samples  map[lagPartition][]offsetSample
+	exported map[lagPartition]bool
+}
+
+type lagPartition struct {
+	group     string
+	topic     string
+	partition int32
+}
+
+type offsetSample struct {
+	offset int64
+	at     time.Time
+}
+
+// NewLagCollector collects the lag of the groups on their topics every interval, no topics means all
+// the topics the group has committed offsets for. A nil log logs to the console
+func NewLagCollector(client sarama.Client, groups map[string][]string, interval time.Duration, log logger) *LagCollector {
+	if log == nil {
+		l := zerolog.New(zerolog.NewConsoleWriter())
+		log = &l
+	}
+	return &LagCollector{
+		client:   client,
+		groups:   groups,
+		interval: interval,
+		logger:   log,
+		samples:  make(map[lagPartition][]offsetSample),
+		exported: make(map[lagPartition]bool),
+	}
+}
+
+// Run collects the lag every interval until ctx is done
+func (c *LagCollector) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		// failures are logged by Collect
+		_, _ = c.Collect()
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Collect fetches the lag of every partition once and updates the metrics, partitions the group has
+// no committed offset for are skipped. A group that fails is logged and keeps its previous metrics,
+// the others are collected anyway and the first error is returned
+func (c *LagCollector) Collect() ([]Lag, error) {
+	var lags []Lag
+	var first error
+	failed := make(map[string]bool)
+	for group, topics := range c.groups {
+		groupLags, err := c.groupLag(group, topics)
+		if err != nil {
+			c.logger.Err(err).Msgf("[kafka] can't collect lag of group %s", group)
+			failed[group] = true
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+		lags = append(lags, groupLags...)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	current := make(map[lagPartition]bool, len(lags))
+	for i := range lags {
+		lag := &lags[i]
+		key := lagPartition{group: lag.Group, topic: lag.Topic, partition: lag.Partition}
+		current[key] = true
+
+		samples := append(c.samples[key], offsetSample{offset: lag.HighWaterMark, at: now})
+		if len(samples) > lagSamples {
+			samples = samples[len(samples)-lagSamples:]
+		}
+		c.samples[key] = samples
+
+		labels := lagLabels(key)
+		Instance().Lag.With(labels).Set(float64(lag.Messages))
+		lag.Delay = -1
+		if delay, ok := estimateDelay(samples, lag.Committed, now); ok {
+			lag.Delay = delay
+			Instance().LagSeconds.With(labels).Set(delay.Seconds())
+		}
+	}
+	// revoked partitions and deleted topics
+	for key := range c.exported {
+		if failed[key.group] {
+			current[key] = true
+		} else if !current[key] {
+			Instance().Lag.Delete(lagLabels(key))
+			Instance().LagSeconds.Delete(lagLabels(key))
+			delete(c.samples, key)
+		}
+	}
+	c.exported = current
+	return lags, first
+}
+
+// groupLag compares the committed offsets of the group with the high-water marks
+func (c *LagCollector) groupLag(group string, topics []string) ([]Lag, error) {
+	committed, err := c.committed(group, topics)
+	if err != nil {
+		return nil, err
+	}
+	var lags []Lag
+	for topic, partitions := range committed {
+		for partition, offset := range partitions {
+			hwm, err := c.client.GetOffset(topic, partition, sarama.OffsetNewest)
+			if err != nil {
+				return nil, fmt.Errorf("[kafka] can't get newest offset topic=%s partition=%d: %w", topic, partition, err)
+			}
+			lags = append(lags, Lag{
+				Group:         group,
+				Topic:         topic,
+				Partition:     partition,
+				Committed:     offset,
+				HighWaterMark: hwm,
+				Messages:      hwm - offset,
+			})
+		}
+	}
+	return lags, nil
+}
+
+// committed fetches the committed offsets of the group, restricted to claims if they are set
+func (c *LagCollector) committed(group string, topics []string) (map[string]map[int32]int64, error) {
+	var claims map[string][]int32
+	if c.claims != nil {
+		claims = c.claims()
+		if len(claims) == 0 {
+			return nil, nil
+		}
+	}
+	if c.consumed != nil {
+		return c.consumed.get(claims), nil
+	}
+
+	coordinator, err := c.client.Coordinator(group)
+	if err != nil {
+		return nil, fmt.Errorf("[kafka] can't get coordinator of group %s: %w", group, err)
+	}
+
+	// version 2 without partitions fetches all the committed ones
+	fetch := &sarama.OffsetFetchRequest{Version: 2, ConsumerGroup: group}
+	added := 0
+	for _, topic := range topics {
+		partitions, ok := claims[topic]
+		if claims == nil {
+			if partitions, err = c.client.Partitions(topic); err != nil {
+				return nil, fmt.Errorf("[kafka] can't get partitions of %s: %w", topic, err)
+			}
+		} else if !ok {
+			continue
+		}
+		for _, p := range partitions {
+			fetch.AddPartition(topic, p)
+			added++
+		}
+	}
+	if len(topics) > 0 && added == 0 {
+		return nil, nil
+	}
+
+	resp, err := coordinator.FetchOffset(fetch)
+	if err != nil {
+		return nil, fmt.Errorf("[kafka] can't fetch offsets of group %s: %w", group, err)
+	}
+	if resp.Err != sarama.ErrNoError {
+		return nil, fmt.Errorf("[kafka] can't fetch offsets of group %s: %w", group, resp.Err)
+	}
+	offsets := make(map[string]map[int32]int64, len(resp.Blocks))
+	for topic, blocks := range resp.Blocks {
+		for partition, block := range blocks {
+			if block.Err != sarama.ErrNoError {
+				return nil, fmt.Errorf("[kafka] can't fetch offset topic=%s partition=%d: %w", topic, partition, block.Err)
+			}
+			if block.Offset < 0 {
+				continue
+			}
+			if offsets[topic] == nil {
+				offsets[topic] = make(map[int32]int64)
+			}
+			offsets[topic][partition] = block.Offset
+		}
+	}
+	return offsets, nil
+}
+
+// consumedOffsets are the next offsets to consume of the partitions of a worker, see consumerHandler.mark
+type consumedOffsets struct {
+	mu      sync.Mutex
+	offsets map[string]map[int32]int64
+}
+
+func (c *consumedOffsets) set(topic string, partition int32, offset int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.offsets == nil {
+		c.offsets = make(map[string]map[int32]int64)
+	}
+	if c.offsets[topic] == nil {
+		c.offsets[topic] = make(map[int32]int64)
+	}
+	c.offsets[topic][partition] = offset
+}
+
+// get returns the offsets of the claims, partitions consumed by other members since are not included
+func (c *consumedOffsets) get(claims map[string][]int32) map[string]map[int32]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	offsets := make(map[string]map[int32]int64, len(claims))
+	for topic, partitions := range claims {
+		for _, partition := range partitions {
+			offset, ok := c.offsets[topic][partition]
+			if !ok {
+				continue
+			}
+			if offsets[topic] == nil {
+				offsets[topic] = make(map[int32]int64)
+			}
+			offsets[topic][partition] = offset
+		}
+	}
+	return offsets
+}
+
+// estimateDelay finds when the high-water mark passed the offset: interpolated between the samples around
+// it or extrapolated with the rate of all the samples if it's older than them
+func estimateDelay(samples []offsetSample, offset int64, now time.Time) (time.Duration, bool) {
+	last := samples[len(samples)-1]
+	if offset >= last.offset {
+		return 0, true
+	}
+
+	after := 0
+	for samples[after].offset <= offset {
+		after++
+	}
+	from, to := samples[0], last
+	if after > 0 {
+		from, to = samples[after-1], samples[after]
+	}
+	if to.offset == from.offset {
+		return 0, false
+	}
+
+	// from.offset is past offset when it's extrapolated
+	at := from.at.Add(time.Duration(float64(to.at.Sub(from.at)) * float64(offset-from.offset) / float64(to.offset-from.offset)))
+	return now.Sub(at), true
+}
+
+func lagLabels(key lagPartition) prometheus.Labels {
+	return prometheus.Labels{
+		"topic":     key.topic,
+		"partition": strconv.Itoa(int(key.partition)),
+		"group":     key.group,
+	}
+}
@@ -0,0 +1,131 @@
+package consumer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestLagCollectSkipsFailedGroup(t *testing.T) {
+	broker := newTestBroker(t)
+	serve(t, broker, map[string]sarama.MockResponse{
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).SetOffset("events", 0, sarama.OffsetNewest, 10),
+		"FindCoordinatorRequest": sarama.NewMockFindCoordinatorResponse(t).
+			SetCoordinator(sarama.CoordinatorGroup, "billing", broker).
+			SetError(sarama.CoordinatorGroup, "denied", sarama.ErrGroupAuthorizationFailed),
+		"OffsetFetchRequest": sarama.NewMockOffsetFetchResponse(t).
+			SetOffset("billing", "events", 0, 4, "", sarama.ErrNoError),
+	})
+	client := connectTestClient(t, broker)
+	client.Config().Metadata.Retry.Max = 0
+
+	c := NewLagCollector(client, map[string][]string{"billing": {"events"}, "denied": {"events"}}, time.Minute, &testLogger)
+	lags, err := c.Collect()
+	if err == nil {
+		t.Fatal("the failed group isn't reported")
+	}
+	if len(lags) != 1 || lags[0].Group != "billing" || lags[0].Messages != 6 || lags[0].Delay != -1 {
+		t.Fatalf("got %+v, want a lag of 6 messages for billing", lags)
+	}
+	labels := prometheus.Labels{"topic": "events", "partition": "0", "group": "billing"}
+	if got := testutil.ToFloat64(Instance().Lag.With(labels)); got != 6 {
+		t.Fatalf("exported lag %v, want 6", got)
+	}
+}
+
+func TestLagOfConsumedOffsets(t *testing.T) {
+	client := newTestClient(t, map[string]sarama.MockResponse{
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).SetOffset("events", 0, sarama.OffsetNewest, 10),
+	})
+	c := NewLagCollector(client, map[string][]string{"consumed": {"events"}}, time.Minute, &testLogger)
+	claims := map[string][]int32{}
+	c.claims = func() map[string][]int32 { return claims }
+	c.consumed = &consumedOffsets{}
+	c.consumed.set("events", 0, 7)
+
+	// nothing is claimed
+	if lags, err := c.Collect(); err != nil || len(lags) != 0 {
+		t.Fatalf("got %+v, %v without claims", lags, err)
+	}
+	claims["events"] = []int32{0, 1}
+	lags, err := c.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lags) != 1 || lags[0].Committed != 7 || lags[0].Messages != 3 {
+		t.Fatalf("got %+v, want a lag of 3 messages", lags)
+	}
+}
+
+func TestEstimateDelay(t *testing.T) {
+	now := time.Now()
+	samples := []offsetSample{
+		{offset: 100, at: now.Add(-20 * time.Second)},
+		{offset: 200, at: now.Add(-10 * time.Second)},
+		{offset: 300, at: now},
+	}
+	for _, tt := range []struct {
+		offset int64
+		want   time.Duration
+	}{
+		{offset: 300, want: 0},
+		{offset: 350, want: 0},
+		{offset: 250, want: 5 * time.Second},
+		{offset: 150, want: 15 * time.Second},
+		// older than the samples, extrapolated with their rate
+		{offset: 50, want: 25 * time.Second},
+	} {
+		got, ok := estimateDelay(samples, tt.offset, now)
+		if !ok || got != tt.want {
+			t.Errorf("offset %d: got %v %v, want %v", tt.offset, got, ok, tt.want)
+		}
+	}
+
+	if _, ok := estimateDelay([]offsetSample{{offset: 100, at: now}}, 50, now); ok {
+		t.Error("the delay is estimated from a single sample")
+	}
+}
+
+func TestStandaloneLagMetrics(t *testing.T) {
+	// offsets 3 and 4 are never fetched
+	fetch := sarama.NewMockFetchResponse(t, 1)
+	for offset := int64(0); offset < 3; offset++ {
+		fetch.SetMessage("events", 0, offset, sarama.StringEncoder("value"))
+	}
+	fetch.SetHighWaterMark("events", 0, 5)
+	client := newTestClient(t, map[string]sarama.MockResponse{
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).
+			SetOffset("events", 0, sarama.OffsetOldest, 0).
+			SetOffset("events", 0, sarama.OffsetNewest, 5),
+		"FetchRequest": fetch,
+	})
+
+	stop := make(chan struct{})
+	defer close(stop)
+	_, result := runWorker(t, stop,
+		Client(client),
+		Topics([]string{"events"}),
+		StartOffset(sarama.OffsetOldest),
+		PartitionRefresh(0),
+		LagMetrics(10*time.Millisecond),
+		Handler(func(ctx context.Context, msg Message) error { return nil }),
+	)
+
+	labels := prometheus.Labels{"topic": "events", "partition": "0", "group": ""}
+	defer Instance().Lag.Delete(labels)
+	deadline := time.Now().Add(5 * time.Second)
+	for testutil.ToFloat64(Instance().Lag.With(labels)) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("the lag of the standalone worker isn't exported")
+		}
+		select {
+		case err := <-result:
+			t.Fatalf("Run returned %v", err)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package consumer
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Shopify/sarama"
+)
+
+// Message is a consumed record, Msg is built by BuilderFn (nil if it's not set)
+type Message struct {
+	*sarama.ConsumerMessage
+	Msg KafkaMsg
+
+	// settle is set for messages delivered to MessageChan
+	settle func(err error)
+	once   *sync.Once
+}
+
+// Ack tells the worker the message is processed, its offset is committed once all previous messages
+// of the partition are acked too. It's a no-op in Handler mode
+func (m *Message) Ack() {
+	m.done(nil)
+}
+
+// Nack tells the worker the message failed, it goes to OnFailure. Without OnFailure (or if it fails)
+// the message is delivered again after the backoff, so it's retried until it's acked
+func (m *Message) Nack(err error) {
+	m.done(err)
+}
+
+func (m *Message) done(err error) {
+	if m.settle == nil {
+		return
+	}
+	m.once.Do(func() {
+		m.settle(err)
+	})
+}
+
+// HandlerFunc processes a message, the offset is marked only after it returns nil
+type HandlerFunc func(ctx context.Context, msg Message) error
+
+// FailureHandler is called when a message still fails after all attempts, nil error means the failure is handled
+// (e.g. the message is stored elsewhere) and the offset can be marked, otherwise the message is retried again
+type FailureHandler func(ctx context.Context, msg Message, err error) error
+
+// RebalanceHandler is called with the claims of a session, see OnPartitionsAssigned and OnPartitionsRevoked
+type RebalanceHandler func(session sarama.ConsumerGroupSession, claims map[string][]int32)
+
+// BatchHandlerFunc processes a batch of messages of one partition, the offsets are marked only after it returns nil
+type BatchHandlerFunc func(ctx context.Context, msgs []Message) error
+
+// Batch is a set of messages of one partition delivered to BatchChan
+type Batch struct {
+	Messages []Message
+
+	settle func(err error)
+	once   sync.Once
+}
+
+// Ack tells the worker all messages of the batch are processed
+func (b *Batch) Ack() {
+	b.done(nil)
+}
+
+// Nack passes every message of the batch to OnFailure, see Message.Nack
+func (b *Batch) Nack(err error) {
+	b.done(err)
+}
+
+func (b *Batch) done(err error) {
+	if b.settle == nil {
+		return
+	}
+	b.once.Do(func() {
+		b.settle(err)
+	})
+}
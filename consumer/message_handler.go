@@ -1,7 +1,9 @@
 package consumer
 
 import (
+	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/Shopify/sarama"
@@ -13,17 +15,57 @@ type KafkaMsg interface {
 
 type msgBuilder func(msg *sarama.ConsumerMessage) (KafkaMsg, error)
 
+// maxBackoff caps the exponential backoff between handler attempts
+const maxBackoff = time.Minute
+
 type msgHandler struct {
 	queue     chan *KafkaMsg
+	messages  chan *Message
+	closeOnce sync.Once
 	batchSize int
 	logger    logger
 	builder   msgBuilder
 	readSince time.Time
+	// filterByTime skips messages with Time() before readSince, the start offsets are resolved by the broker anyway
+	filterByTime bool
+
+	handler      HandlerFunc
+	batchHandler BatchHandlerFunc
+	batches      chan *Batch
+	linger       time.Duration
+	timeout      time.Duration
+	attempts     int
+	backoff      time.Duration
+	onFailure    FailureHandler
+	// delayed messages wait for their HeaderRetryDue, see RetryTopics
+	delayed bool
+	// unacked counts messages delivered to MessageChan and BatchChan and not settled yet
+	unacked int64
 }
 
 type HandlerConfig struct {
 	BatchSize int
 	ReadSince time.Time
+	// FilterByTime additionally skips built messages with Time() not after ReadSince
+	FilterByTime bool
+
+	// Messages replaces the queue, messages are delivered with Ack/Nack
+	Messages chan *Message
+	// Handler replaces the queue, it's called for every message
+	Handler HandlerFunc
+	// BatchHandler and Batches replace the queue, BatchSize messages of a partition are delivered at once,
+	// or less if Linger elapses since the first message of the batch
+	BatchHandler BatchHandlerFunc
+	Batches      chan *Batch
+	Linger       time.Duration
+	// Timeout bounds a single Handler call, 0 means no limit
+	Timeout time.Duration
+	// Attempts before OnFailure is called, Backoff doubles after every failed attempt
+	Attempts  int
+	Backoff   time.Duration
+	OnFailure FailureHandler
+	// Delayed messages are handled once their HeaderRetryDue time comes
+	Delayed bool
 }
 
 func newMsgHandler(ch chan *KafkaMsg, cfg *HandlerConfig, log logger, builder msgBuilder) *msgHandler {
@@ -31,10 +73,22 @@ func newMsgHandler(ch chan *KafkaMsg, cfg *HandlerConfig, log logger, builder ms
 		log.Error().Msg("[kafka] read since not set")
 	}
 	h := &msgHandler{
-		queue:     ch,
-		builder:   builder,
-		readSince: cfg.ReadSince,
-		logger:    log,
+		queue:        ch,
+		messages:     cfg.Messages,
+		batchSize:    cfg.BatchSize,
+		builder:      builder,
+		readSince:    cfg.ReadSince,
+		filterByTime: cfg.FilterByTime,
+		logger:       log,
+		handler:      cfg.Handler,
+		batchHandler: cfg.BatchHandler,
+		batches:      cfg.Batches,
+		linger:       cfg.Linger,
+		timeout:      cfg.Timeout,
+		attempts:     cfg.Attempts,
+		backoff:      cfg.Backoff,
+		onFailure:    cfg.OnFailure,
+		delayed:      cfg.Delayed,
 	}
 	return h
 }
@@ -42,17 +96,200 @@ func (h *msgHandler) initQueue() {
 	// h.queue = make(chan *any, h.batchSize/2)
 }
 func (h *msgHandler) closeQueue() {
-	close(h.queue)
+	h.closeOnce.Do(func() {
+		if h.queue != nil {
+			close(h.queue)
+		}
+		if h.messages != nil {
+			close(h.messages)
+		}
+		if h.batches != nil {
+			close(h.batches)
+		}
+	})
 }
 
-func (h *msgHandler) handle(msg *sarama.ConsumerMessage) error {
+// handle builds the message and sends it to DestinationChan, an error equal to ctx.Err() means the session
+// is over before the reader took it
+func (h *msgHandler) handle(ctx context.Context, msg *sarama.ConsumerMessage) error {
 	m, err := h.builder(msg)
 	if err != nil {
 		return err
 	}
-	if h.readSince.IsZero() || m.Time() > h.readSince.Unix() {
-		h.queue <- &m
+	if h.skip(m) {
+		return errSkip
+	}
+	select {
+	case h.queue <- &m:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// skip is true if payload time filtering is on and the message isn't newer than readSince
+func (h *msgHandler) skip(m KafkaMsg) bool {
+	return h.filterByTime && !h.readSince.IsZero() && m.Time() <= h.readSince.Unix()
+}
+
+// process runs the handler until it succeeds or the failure is handled, it returns an error only
+// if ctx is done (the session is over) and the offset must not be marked
+func (h *msgHandler) process(ctx context.Context, msg *sarama.ConsumerMessage) error {
+	m := Message{ConsumerMessage: msg}
+	backoff := h.backoff
+
+	for attempt := 1; ; attempt++ {
+		err := h.call(ctx, &m)
+		if err == nil || err == errSkip {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		h.logger.Err(err).Msgf("[kafka] failed to handle message topic=%s partition=%d offset=%d attempt=%d",
+			msg.Topic, msg.Partition, msg.Offset, attempt)
+		countError(msg, err)
+
+		if h.onFailure != nil && attempt >= h.attempts {
+			ferr := h.onFailure(ctx, m, err)
+			if ferr == nil {
+				return nil
+			}
+			h.logger.Err(ferr).Msg("[kafka] failure handler failed, retrying the message")
+		}
+
+		if !h.sleep(ctx, &backoff) {
+			return ctx.Err()
+		}
+	}
+}
+
+// errSkip marks messages filtered out by readSince, see FilterByTime
+var errSkip = fmt.Errorf("message less than set readSince")
+
+func (h *msgHandler) call(ctx context.Context, m *Message) error {
+	if err := h.build(m); err != nil {
+		return err
+	}
+
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+	return h.handler(ctx, *m)
+}
+
+// build sets Msg if BuilderFn is configured, errSkip means the message is filtered out by readSince
+func (h *msgHandler) build(m *Message) error {
+	if h.builder == nil || m.Msg != nil {
 		return nil
 	}
-	return fmt.Errorf("message less than set readSince")
+	built, err := h.builder(m.ConsumerMessage)
+	if err != nil {
+		return err
+	}
+	if h.skip(built) {
+		return errSkip
+	}
+	m.Msg = built
+	return nil
+}
+
+// failed reports a message that failed for good, true means OnFailure handled it and the offset can be marked
+func (h *msgHandler) failed(ctx context.Context, m Message, err error) bool {
+	h.logger.Err(err).Msgf("[kafka] failed to handle message topic=%s partition=%d offset=%d",
+		m.Topic, m.Partition, m.Offset)
+	countError(m.ConsumerMessage, err)
+
+	if h.onFailure == nil {
+		return false
+	}
+	if ferr := h.onFailure(ctx, m, err); ferr != nil {
+		h.logger.Err(ferr).Msg("[kafka] failure handler failed")
+		return false
+	}
+	return true
+}
+
+// buildFailed reports a message BuilderFn can't build: without OnFailure it's logged and skipped as in
+// DestinationChan mode, otherwise OnFailure has to handle it. false means ctx is done and the offset
+// must not be marked
+func (h *msgHandler) buildFailed(ctx context.Context, m Message, err error) bool {
+	if err == errSkip {
+		return true
+	}
+	if h.onFailure == nil {
+		h.failed(ctx, m, err)
+		return true
+	}
+	return h.failedForGood(ctx, m, err)
+}
+
+// failedForGood calls OnFailure until it handles the message, an error means ctx is done
+// and the offset must not be marked
+func (h *msgHandler) failedForGood(ctx context.Context, m Message, err error) bool {
+	backoff := h.backoff
+	for !h.failed(ctx, m, err) {
+		if !h.sleep(ctx, &backoff) {
+			return false
+		}
+	}
+	return true
+}
+
+// processBatch runs the batch handler until it succeeds or OnFailure handles every message of the batch,
+// it returns an error only if ctx is done
+func (h *msgHandler) processBatch(ctx context.Context, msgs []Message) error {
+	backoff := h.backoff
+	for attempt := 1; ; attempt++ {
+		err := h.callBatch(ctx, msgs)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		h.logger.Err(err).Msgf("[kafka] failed to handle batch of %d messages topic=%s partition=%d attempt=%d",
+			len(msgs), msgs[0].Topic, msgs[0].Partition, attempt)
+
+		if h.onFailure != nil && attempt >= h.attempts {
+			// handled messages leave the batch, the rest is retried
+			left := msgs[:0:0]
+			for _, m := range msgs {
+				if !h.failed(ctx, m, err) {
+					left = append(left, m)
+				}
+			}
+			if msgs = left; len(msgs) == 0 {
+				return nil
+			}
+		}
+
+		if !h.sleep(ctx, &backoff) {
+			return ctx.Err()
+		}
+	}
+}
+
+func (h *msgHandler) callBatch(ctx context.Context, msgs []Message) error {
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+	return h.batchHandler(ctx, msgs)
+}
+
+// sleep waits for the backoff and doubles it, false means ctx is done
+func (h *msgHandler) sleep(ctx context.Context, backoff *time.Duration) bool {
+	select {
+	case <-time.After(*backoff):
+	case <-ctx.Done():
+		return false
+	}
+	if *backoff *= 2; *backoff > maxBackoff {
+		*backoff = maxBackoff
+	}
+	return true
 }
@@ -10,6 +10,8 @@ type Metrics struct {
 	TotalEvents   *prometheus.CounterVec
 	TotalDuration *prometheus.HistogramVec
 	TotalErrors   *prometheus.CounterVec
+	Lag           *prometheus.GaugeVec
+	LagSeconds    *prometheus.GaugeVec
 }
 
 var (
@@ -52,7 +54,25 @@ func (m *Metrics) initMetrics() {
 		[]string{"partition", "topic"},
 	)
 
+	m.Lag = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kafka_consumer_lag",
+			Help: "отставание группы в сообщениях",
+		},
+		[]string{"topic", "partition", "group"},
+	)
+
+	m.LagSeconds = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kafka_consumer_lag_seconds",
+			Help: "оценка отставания группы в секундах",
+		},
+		[]string{"topic", "partition", "group"},
+	)
+
 	prometheus.MustRegister(m.TotalEvents)
 	prometheus.MustRegister(m.TotalErrors)
 	prometheus.MustRegister(m.TotalDuration)
+	prometheus.MustRegister(m.Lag)
+	prometheus.MustRegister(m.LagSeconds)
 }
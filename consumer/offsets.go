@@ -0,0 +1,77 @@
+package consumer
+
+import (
+	"sync"
+)
+
+// offsetTracker marks the offset up to which every delivered message of a partition is done, so
+// messages finished out of order are never committed past an unfinished one
+type offsetTracker struct {
+	mu sync.Mutex
+	// delivered and not marked yet, ascending
+	offsets []int64
+	done    map[int64]bool
+	mark    func(offset int64)
+	empty   chan struct{}
+}
+
+// newOffsetTracker calls mark with the next offset to consume, i.e. the last done offset + 1
+func newOffsetTracker(mark func(offset int64)) *offsetTracker {
+	return &offsetTracker{
+		done: map[int64]bool{},
+		mark: mark,
+	}
+}
+
+// add registers a delivered message, offsets must be added in order
+func (t *offsetTracker) add(offset int64) {
+	t.mu.Lock()
+	t.offsets = append(t.offsets, offset)
+	t.mu.Unlock()
+}
+
+// finish marks the message done and moves the watermark over all contiguous done messages
+func (t *offsetTracker) finish(offset int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.done[offset] = true
+	n := 0
+	for n < len(t.offsets) && t.done[t.offsets[n]] {
+		delete(t.done, t.offsets[n])
+		n++
+	}
+	if n == 0 {
+		return
+	}
+	t.mark(t.offsets[n-1] + 1)
+	t.offsets = t.offsets[n:]
+
+	if len(t.offsets) == 0 && t.empty != nil {
+		close(t.empty)
+		t.empty = nil
+	}
+}
+
+// pending returns the number of delivered messages which are not done
+func (t *offsetTracker) pending() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.offsets) - len(t.done)
+}
+
+// drained is closed when every delivered message is done
+func (t *offsetTracker) drained() <-chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ch := make(chan struct{})
+	if len(t.offsets) == 0 {
+		close(ch)
+		return ch
+	}
+	if t.empty == nil {
+		t.empty = make(chan struct{})
+	}
+	return t.empty
+}
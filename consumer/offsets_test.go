@@ -0,0 +1,40 @@
+package consumer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOffsetTrackerWatermark(t *testing.T) {
+	var marked []int64
+	tracker := newOffsetTracker(func(offset int64) { marked = append(marked, offset) })
+	for offset := int64(10); offset < 15; offset++ {
+		tracker.add(offset)
+	}
+	drained := tracker.drained()
+
+	for _, offset := range []int64{12, 10, 11, 14} {
+		tracker.finish(offset)
+	}
+	if want := []int64{11, 13}; !reflect.DeepEqual(marked, want) {
+		t.Fatalf("marked %v, want %v", marked, want)
+	}
+	if pending := tracker.pending(); pending != 1 {
+		t.Fatalf("%d pending, want 1", pending)
+	}
+	select {
+	case <-drained:
+		t.Fatal("drained with a pending message")
+	default:
+	}
+
+	tracker.finish(13)
+	if last := marked[len(marked)-1]; last != 15 {
+		t.Fatalf("marked %d, want 15", last)
+	}
+	select {
+	case <-drained:
+	default:
+		t.Fatal("not drained")
+	}
+}
@@ -15,15 +15,47 @@ type options struct {
 	topics     []string
 	kafkaGroup string
 	readSince  time.Time
+	// filterByTime skips messages by KafkaMsg.Time() in addition to the offset lookup
+	filterByTime bool
+
+	// group-less mode
+	partitions       map[string][]int32
+	partitionRefresh time.Duration
+	startOffset      int64
+	hasStartOffset   bool
 
 	ctx        context.Context
 	dest       chan *KafkaMsg
+	messages   chan *Message
+	batches    chan *Batch
 	client     sarama.Client
 	logger     logger
 	keepOffset bool
 
 	builderFn       msgBuilder
 	shutdownSignals []os.Signal
+
+	handler         HandlerFunc
+	batchHandler    BatchHandlerFunc
+	batchLinger     time.Duration
+	handlerTimeout  time.Duration
+	handlerAttempts int
+	handlerBackoff  time.Duration
+	onFailure       FailureHandler
+
+	onAssigned RebalanceHandler
+	onRevoked  RebalanceHandler
+	strategies []sarama.BalanceStrategy
+
+	retry *retrier
+	dlq   *deadLetter
+
+	concurrency int
+
+	pauseHigh int
+	pauseLow  int
+
+	lagInterval time.Duration
 }
 
 func KeepOffset(keepOffset bool) Option {
@@ -74,12 +106,23 @@ func WorkerBatchSize(batchSize int) Option {
 	}
 }
 
+// ReadSince starts every claimed partition at the first offset with a timestamp at or after time, the offsets
+// are resolved by the broker (kafka 0.10.1+). A committed offset past it is kept, see FilterByTime.
+// The default is 60 hours ago
 func ReadSince(time time.Time) Option {
 	return func(o *options) {
 		o.readSince = time
 	}
 }
 
+// FilterByTime also skips built messages with KafkaMsg.Time() not after ReadSince, for payloads whose own time
+// differs from the record timestamp. Skipped messages are not reported as errors
+func FilterByTime(filter bool) Option {
+	return func(o *options) {
+		o.filterByTime = filter
+	}
+}
+
 func Topics(topics []string) Option {
 	return func(o *options) {
 		o.topics = topics
@@ -91,3 +134,143 @@ func Group(group string) Option {
 		o.kafkaGroup = group
 	}
 }
+
+// Handler is called for every message instead of sending it to DestinationChan, BuilderFn is optional in this mode.
+// The offset is marked only after the handler returns nil, failed messages are retried, see Retries and OnFailure
+func Handler(h HandlerFunc) Option {
+	return func(o *options) {
+		o.handler = h
+	}
+}
+
+// HandlerTimeout bounds a single Handler call
+func HandlerTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.handlerTimeout = timeout
+	}
+}
+
+// Retries sets how many times a message is handled before OnFailure is called and the first backoff between
+// attempts, it doubles after every attempt
+func Retries(attempts int, backoff time.Duration) Option {
+	return func(o *options) {
+		o.handlerAttempts = attempts
+		o.handlerBackoff = backoff
+	}
+}
+
+// OnFailure is called when a message still fails after all attempts. Without it the message is retried
+// until it succeeds, so the partition doesn't move past it. It's replaced by RetryTopics
+func OnFailure(h FailureHandler) Option {
+	return func(o *options) {
+		o.onFailure = h
+	}
+}
+
+// MessageChan delivers messages with Ack/Nack instead of DestinationChan, BuilderFn is optional in this mode,
+// messages it can't build go to OnFailure or are logged and skipped without it.
+// With KeepOffset(true) offsets are committed only up to the contiguous acked messages of each partition
+func MessageChan(ch chan *Message) Option {
+	return func(o *options) {
+		o.messages = ch
+	}
+}
+
+// BatchHandler is called with up to WorkerBatchSize messages of one partition, see BatchLinger.
+// The offsets are marked after it returns nil, failed batches are retried as in Handler mode
+func BatchHandler(h BatchHandlerFunc) Option {
+	return func(o *options) {
+		o.batchHandler = h
+	}
+}
+
+// BatchChan delivers batches with Ack/Nack, see BatchHandler and MessageChan
+func BatchChan(ch chan *Batch) Option {
+	return func(o *options) {
+		o.batches = ch
+	}
+}
+
+// BatchLinger is the max time a batch waits to be filled since its first message
+func BatchLinger(linger time.Duration) Option {
+	return func(o *options) {
+		o.batchLinger = linger
+	}
+}
+
+// Partitions selects partitions of the topics in group-less mode (Group is not set), topics missing
+// in the map are consumed entirely
+func Partitions(partitions map[string][]int32) Option {
+	return func(o *options) {
+		o.partitions = partitions
+	}
+}
+
+// StartOffset is where group-less consumption starts: sarama.OffsetOldest, sarama.OffsetNewest or an offset.
+// It overrides ReadSince, without both partitions are consumed from the oldest offset
+func StartOffset(offset int64) Option {
+	return func(o *options) {
+		o.startOffset = offset
+		o.hasStartOffset = true
+	}
+}
+
+// PartitionRefresh is how often group-less mode checks for new partitions, 0 disables it.
+// New partitions are consumed from the oldest offset
+func PartitionRefresh(interval time.Duration) Option {
+	return func(o *options) {
+		o.partitionRefresh = interval
+	}
+}
+
+// OnPartitionsAssigned is called when a session starts, before its claims are consumed. Without a group
+// it's called with the partitions started by the worker, including the ones added later
+func OnPartitionsAssigned(h RebalanceHandler) Option {
+	return func(o *options) {
+		o.onAssigned = h
+	}
+}
+
+// OnPartitionsRevoked is called when a session ends, after its claims are consumed and before the offsets
+// are committed for the last time. Without a group it's called with all partitions when the worker stops
+func OnPartitionsRevoked(h RebalanceHandler) Option {
+	return func(o *options) {
+		o.onRevoked = h
+	}
+}
+
+// RebalanceStrategy sets the priority-ordered partition assignment strategies of the group, e.g.
+// sarama.BalanceStrategyRange (default), sarama.BalanceStrategyRoundRobin or sarama.BalanceStrategySticky.
+// The worker connects its own client with it, the other users of the shared client are not affected
+func RebalanceStrategy(strategies ...sarama.BalanceStrategy) Option {
+	return func(o *options) {
+		o.strategies = strategies
+	}
+}
+
+// Concurrency makes n goroutines call Handler for the messages of each partition, messages with the same key
+// go to the same goroutine in order. Offsets are marked up to the lowest message not handled yet
+func Concurrency(n int) Option {
+	return func(o *options) {
+		o.concurrency = n
+	}
+}
+
+// AutoPause pauses fetching when the backlog of delivered messages reaches high and resumes it when it drops
+// to low, so a slow reader doesn't stall the session. The backlog is the buffered messages of DestinationChan
+// (its capacity must exceed high) or the messages of MessageChan and BatchChan not acked yet. Handlers are
+// not supported, they hold one message or batch per partition anyway
+func AutoPause(high, low int) Option {
+	return func(o *options) {
+		o.pauseHigh = high
+		o.pauseLow = low
+	}
+}
+
+// LagMetrics exports the lag of the partitions claimed by the worker every interval, see LagCollector.
+// The committed offsets are used with KeepOffset, the consumed positions of the claims otherwise
+func LagMetrics(interval time.Duration) Option {
+	return func(o *options) {
+		o.lagInterval = interval
+	}
+}
@@ -0,0 +1,69 @@
+package consumer
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"github.com/Shopify/sarama"
+)
+
+// laneBuffer is how many messages a lane holds before the claim loop waits for it
+const laneBuffer = 64
+
+// consumeParallel passes messages of the claim to concurrency goroutines (lanes) by key hash, so messages
+// with the same key are handled in order while a slow key blocks its lane only.
+// The offset is marked up to the contiguous handled messages
+func (h *consumerHandler) consumeParallel(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	ctx := session.Context()
+	tracker := newOffsetTracker(func(offset int64) {
+		h.mark(session, claim.Topic(), claim.Partition(), offset)
+	})
+
+	var wg sync.WaitGroup
+	lanes := make([]chan *sarama.ConsumerMessage, h.concurrency)
+	for i := range lanes {
+		lanes[i] = make(chan *sarama.ConsumerMessage, laneBuffer)
+		wg.Add(1)
+		go func(lane <-chan *sarama.ConsumerMessage) {
+			defer wg.Done()
+			for msg := range lane {
+				// the session is over, the rest of the lane is consumed again by the next one
+				if ctx.Err() != nil || h.msgHandler.process(ctx, msg) != nil {
+					continue
+				}
+				countEvent(msg)
+				tracker.finish(msg.Offset)
+			}
+		}(lanes[i])
+	}
+	defer func() {
+		for _, lane := range lanes {
+			close(lane)
+		}
+		wg.Wait()
+	}()
+
+	for msg := range claim.Messages() {
+		if !h.msgHandler.waitDue(ctx, msg) {
+			return nil
+		}
+		tracker.add(msg.Offset)
+
+		select {
+		case lanes[laneOf(msg, len(lanes))] <- msg:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	return nil
+}
+
+// laneOf hashes the key, messages without a key have no order to keep and are spread by offset
+func laneOf(msg *sarama.ConsumerMessage, lanes int) int {
+	if len(msg.Key) == 0 {
+		return int(msg.Offset % int64(lanes))
+	}
+	hash := fnv.New32a()
+	_, _ = hash.Write(msg.Key)
+	return int(hash.Sum32() % uint32(lanes))
+}
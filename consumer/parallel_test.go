@@ -0,0 +1,103 @@
+package consumer
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+func newParallelHandler(concurrency int, handler func(ctx context.Context, msg Message) error) *consumerHandler {
+	h := newTestHandler(&HandlerConfig{Handler: handler}, nil)
+	h.concurrency = concurrency
+	return h
+}
+
+func TestParallelKeepsKeyOrder(t *testing.T) {
+	var mu sync.Mutex
+	handled := map[string][]int64{}
+	h := newParallelHandler(3, func(ctx context.Context, msg Message) error {
+		// later messages of a key must wait for the slow earlier ones
+		time.Sleep(time.Duration(30-msg.Offset) * 100 * time.Microsecond)
+		mu.Lock()
+		handled[string(msg.Key)] = append(handled[string(msg.Key)], msg.Offset)
+		mu.Unlock()
+		return nil
+	})
+	session := newTestSession(context.Background())
+
+	waitDone(t, consumeAsync(h, session, newTestClaim(30)))
+	for key, offsets := range handled {
+		if len(offsets) != 10 {
+			t.Fatalf("key %s handled %d times, want 10", key, len(offsets))
+		}
+		for i := 1; i < len(offsets); i++ {
+			if offsets[i] < offsets[i-1] {
+				t.Fatalf("key %s handled out of order: %v", key, offsets)
+			}
+		}
+	}
+	if got := session.lastMarked(); got != 30 {
+		t.Fatalf("marked %d, want 30", got)
+	}
+}
+
+func TestParallelMarksContiguousMessages(t *testing.T) {
+	release := make(chan struct{})
+	handledC := make(chan int64, 10)
+	// with 3 lanes keys a and b share a lane, c has its own
+	h := newParallelHandler(3, func(ctx context.Context, msg Message) error {
+		switch string(msg.Key) {
+		case "a":
+			if msg.Offset == 0 {
+				<-release
+			}
+		case "c":
+			handledC <- msg.Offset
+		}
+		return nil
+	})
+	session := newTestSession(context.Background())
+	done := consumeAsync(h, session, newTestClaim(9))
+
+	for _, want := range []int64{2, 5, 8} {
+		select {
+		case got := <-handledC:
+			if got != want {
+				t.Fatalf("key c handled offset %d, want %d", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("key c is blocked by the slow key a")
+		}
+	}
+	if got := session.lastMarked(); got != -1 {
+		t.Fatalf("marked %d while offset 0 is handled", got)
+	}
+	close(release)
+	waitDone(t, done)
+	if got := session.lastMarked(); got != 9 {
+		t.Fatalf("marked %d, want 9", got)
+	}
+}
+
+func TestLaneOf(t *testing.T) {
+	msg := &sarama.ConsumerMessage{Key: []byte("order-1"), Offset: 1}
+	lane := laneOf(msg, 8)
+	for offset := int64(2); offset < 10; offset++ {
+		msg.Offset = offset
+		if got := laneOf(msg, 8); got != lane {
+			t.Fatalf("offset %d of the key went to lane %d, want %d", offset, got, lane)
+		}
+	}
+
+	// messages without a key are spread
+	keyless := map[int]bool{}
+	for offset := int64(0); offset < 8; offset++ {
+		keyless[laneOf(&sarama.ConsumerMessage{Offset: offset}, 8)] = true
+	}
+	if len(keyless) != 8 {
+		t.Fatalf("messages without a key use %d lanes, want 8", len(keyless))
+	}
+}
@@ -0,0 +1,150 @@
+package consumer
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// flowCheckInterval is how often AutoPause checks the backlog
+const flowCheckInterval = time.Millisecond * 100
+
+// pauser stops fetching partitions without leaving the group, sarama.ConsumerGroup and sarama.Consumer implement it
+type pauser interface {
+	Pause(partitions map[string][]int32)
+	Resume(partitions map[string][]int32)
+	PauseAll()
+	ResumeAll()
+}
+
+// Pause stops fetching the partitions until Resume, the session and its heartbeats go on.
+// In a group the partitions are fetched again after a rebalance
+func (w *Worker) Pause(partitions map[string][]int32) error {
+	consumer := w.current()
+	if consumer == nil {
+		return ErrNotRunning
+	}
+
+	w.mu.Lock()
+	if w.paused == nil {
+		w.paused = make(map[string]map[int32]bool)
+	}
+	for topic, ps := range partitions {
+		if w.paused[topic] == nil {
+			w.paused[topic] = make(map[int32]bool)
+		}
+		for _, p := range ps {
+			w.paused[topic][p] = true
+		}
+	}
+	w.mu.Unlock()
+
+	consumer.Pause(partitions)
+	return nil
+}
+
+// Resume fetches the partitions paused by Pause again
+func (w *Worker) Resume(partitions map[string][]int32) error {
+	consumer := w.current()
+	if consumer == nil {
+		return ErrNotRunning
+	}
+
+	w.mu.Lock()
+	for topic, ps := range partitions {
+		for _, p := range ps {
+			delete(w.paused[topic], p)
+		}
+	}
+	w.mu.Unlock()
+
+	consumer.Resume(partitions)
+	return nil
+}
+
+// PauseAll pauses all partitions of the worker, see Pause
+func (w *Worker) PauseAll() error {
+	consumer := w.current()
+	if consumer == nil {
+		return ErrNotRunning
+	}
+	w.mu.Lock()
+	w.pausedAll = true
+	w.mu.Unlock()
+
+	consumer.PauseAll()
+	return nil
+}
+
+// ResumeAll resumes all partitions of the worker
+func (w *Worker) ResumeAll() error {
+	consumer := w.current()
+	if consumer == nil {
+		return ErrNotRunning
+	}
+	w.mu.Lock()
+	w.paused, w.pausedAll = nil, false
+	w.mu.Unlock()
+
+	consumer.ResumeAll()
+	return nil
+}
+
+// flowControl pauses all partitions when the backlog reaches pauseHigh and resumes them when it drops
+// to pauseLow, the partitions paused by Pause and PauseAll stay paused
+func (w *Worker) flowControl(ctx context.Context, handler *msgHandler, consumer pauser) {
+	ticker := time.NewTicker(flowCheckInterval)
+	defer ticker.Stop()
+
+	paused := false
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		backlog := handler.backlog()
+		switch {
+		case backlog >= w.pauseHigh:
+			// repeated, the partitions of a new session start unpaused
+			consumer.PauseAll()
+			if !paused {
+				w.logger.Warn().Msgf("[kafka] backlog of %d messages, consumption paused", backlog)
+				paused = true
+			}
+		case paused && backlog <= w.pauseLow:
+			w.resumeAuto(consumer)
+			w.logger.Info().Msgf("[kafka] backlog of %d messages, consumption resumed", backlog)
+			paused = false
+		}
+	}
+}
+
+func (w *Worker) resumeAuto(consumer pauser) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.pausedAll {
+		return
+	}
+
+	consumer.ResumeAll()
+	partitions := make(map[string][]int32, len(w.paused))
+	for topic, ps := range w.paused {
+		for p := range ps {
+			partitions[topic] = append(partitions[topic], p)
+		}
+	}
+	if len(partitions) > 0 {
+		consumer.Pause(partitions)
+	}
+}
+
+// backlog is the number of delivered messages the application hasn't finished: buffered in DestinationChan,
+// or not acked yet for MessageChan and BatchChan
+func (h *msgHandler) backlog() int {
+	if h.queue != nil {
+		return len(h.queue)
+	}
+	return int(atomic.LoadInt64(&h.unacked))
+}
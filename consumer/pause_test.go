@@ -0,0 +1,113 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// testPauser sends the calls to the channel
+type testPauser struct {
+	calls chan string
+}
+
+func (p *testPauser) Pause(partitions map[string][]int32) {
+	p.calls <- fmt.Sprint("pause ", partitions)
+}
+func (p *testPauser) Resume(partitions map[string][]int32) {
+	p.calls <- fmt.Sprint("resume ", partitions)
+}
+func (p *testPauser) PauseAll()  { p.calls <- "pause all" }
+func (p *testPauser) ResumeAll() { p.calls <- "resume all" }
+
+// expect skips the PauseAll calls repeated while the backlog is high
+func (p *testPauser) expect(t *testing.T, want string) {
+	t.Helper()
+	for {
+		select {
+		case got := <-p.calls:
+			if got == want {
+				return
+			}
+			if got != "pause all" {
+				t.Fatalf("got %q, want %q", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no %q", want)
+		}
+	}
+}
+
+func buildTestMsg(*sarama.ConsumerMessage) (KafkaMsg, error) { return testKafkaMsg{}, nil }
+
+func TestAutoPauseValidation(t *testing.T) {
+	handler := Handler(func(ctx context.Context, msg Message) error { return nil })
+	for name, opts := range map[string][]Option{
+		"low must be less than high": {DestinationChan(make(chan *KafkaMsg, 10)), BuilderFn(buildTestMsg), AutoPause(5, 5)},
+		"requires DestinationChan":   {handler, AutoPause(10, 1)},
+		"buffered for more than":     {DestinationChan(make(chan *KafkaMsg, 10)), BuilderFn(buildTestMsg), AutoPause(10, 1)},
+	} {
+		err := New(append(opts, Topics([]string{"events"}), LoggerSet(&testLogger))...).Run()
+		if err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("got %v, want %q", err, name)
+		}
+	}
+}
+
+func TestFlowControl(t *testing.T) {
+	queue := make(chan *KafkaMsg, 10)
+	w := New(DestinationChan(queue), BuilderFn(buildTestMsg), AutoPause(3, 1), LoggerSet(&testLogger))
+	w.paused = map[string]map[int32]bool{"events": {2: true}}
+	consumer := &testPauser{calls: make(chan string, 16)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.flowControl(ctx, newMsgHandler(queue, &HandlerConfig{}, &testLogger, buildTestMsg), consumer)
+
+	msg := KafkaMsg(testKafkaMsg{})
+	for i := 0; i < 3; i++ {
+		queue <- &msg
+	}
+	consumer.expect(t, "pause all")
+
+	<-queue
+	<-queue
+	// the partition paused by Pause stays paused
+	consumer.expect(t, "resume all")
+	consumer.expect(t, "pause map[events:[2]]")
+}
+
+func TestDestinationStopsWithSession(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	h := newConsumerHandler(newMsgHandler(make(chan *KafkaMsg), &HandlerConfig{}, &testLogger, buildTestMsg),
+		nil, true, &testLogger)
+	session := newTestSession(ctx)
+	done := consumeAsync(h, session, newTestClaim(3))
+
+	// nobody reads the destination
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	waitDone(t, done)
+	if got := session.lastMarked(); got != -1 {
+		t.Fatalf("marked %d, nothing was received", got)
+	}
+}
+
+func TestPauseNotRunning(t *testing.T) {
+	w := New(Topics([]string{"events"}), Handler(func(ctx context.Context, msg Message) error { return nil }))
+	partitions := map[string][]int32{"events": {0}}
+	for name, err := range map[string]error{
+		"Pause":     w.Pause(partitions),
+		"Resume":    w.Resume(partitions),
+		"PauseAll":  w.PauseAll(),
+		"ResumeAll": w.ResumeAll(),
+	} {
+		if !errors.Is(err, ErrNotRunning) {
+			t.Errorf("%s returned %v", name, err)
+		}
+	}
+}
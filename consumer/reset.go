@@ -0,0 +1,157 @@
+package consumer
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// OffsetReset resolves the new offset of a partition for ResetGroupOffsets, committed is -1 if the group
+// has no offset for the partition. See ToEarliest, ToLatest, ToTimestamp and ShiftBy
+type OffsetReset func(client sarama.Client, topic string, partition int32, committed int64) (int64, error)
+
+// ToEarliest resets to the oldest available offset
+func ToEarliest() OffsetReset {
+	return func(client sarama.Client, topic string, partition int32, _ int64) (int64, error) {
+		return client.GetOffset(topic, partition, sarama.OffsetOldest)
+	}
+}
+
+// ToLatest resets to the end of the partition
+func ToLatest() OffsetReset {
+	return func(client sarama.Client, topic string, partition int32, _ int64) (int64, error) {
+		return client.GetOffset(topic, partition, sarama.OffsetNewest)
+	}
+}
+
+// ToTimestamp resets to the first offset with a timestamp at or after ts
+func ToTimestamp(ts time.Time) OffsetReset {
+	return func(client sarama.Client, topic string, partition int32, _ int64) (int64, error) {
+		return offsetForTime(client, topic, partition, ts.UnixMilli())
+	}
+}
+
+// ShiftBy moves the committed offset by n, negative n moves back. Partitions without a committed offset
+// are shifted from the client's Consumer.Offsets.Initial
+func ShiftBy(n int64) OffsetReset {
+	return func(client sarama.Client, topic string, partition int32, committed int64) (int64, error) {
+		if committed < 0 {
+			initial, err := client.GetOffset(topic, partition, client.Config().Consumer.Offsets.Initial)
+			if err != nil {
+				return 0, err
+			}
+			committed = initial
+		}
+		return committed + n, nil
+	}
+}
+
+// ResetGroupOffsets commits new offsets of the group for every partition of the topics, like
+// kafka-consumer-groups --reset-offsets. The offsets are kept within the available range and returned.
+// The group must have no active members, stop its workers first
+func ResetGroupOffsets(client sarama.Client, group string, topics []string, reset OffsetReset) (map[string]map[int32]int64, error) {
+	coordinator, err := client.Coordinator(group)
+	if err != nil {
+		return nil, fmt.Errorf("[kafka] can't get coordinator of group %s: %w", group, err)
+	}
+	if err := checkGroupInactive(coordinator, group); err != nil {
+		return nil, err
+	}
+
+	fetch := &sarama.OffsetFetchRequest{Version: 1, ConsumerGroup: group}
+	partitions := make(map[string][]int32, len(topics))
+	for _, topic := range topics {
+		ps, err := client.Partitions(topic)
+		if err != nil {
+			return nil, fmt.Errorf("[kafka] can't get partitions of %s: %w", topic, err)
+		}
+		partitions[topic] = ps
+		for _, p := range ps {
+			fetch.AddPartition(topic, p)
+		}
+	}
+	committed, err := coordinator.FetchOffset(fetch)
+	if err != nil {
+		return nil, fmt.Errorf("[kafka] can't fetch offsets of group %s: %w", group, err)
+	}
+
+	commit := &sarama.OffsetCommitRequest{
+		Version:                 2,
+		ConsumerGroup:           group,
+		ConsumerGroupGeneration: sarama.GroupGenerationUndefined,
+		RetentionTime:           -1,
+	}
+	offsets := make(map[string]map[int32]int64, len(topics))
+	for topic, ps := range partitions {
+		offsets[topic] = make(map[int32]int64, len(ps))
+		for _, p := range ps {
+			current := int64(-1)
+			if block := committed.GetBlock(topic, p); block != nil {
+				if block.Err != sarama.ErrNoError {
+					return nil, fmt.Errorf("[kafka] can't fetch offset topic=%s partition=%d: %w", topic, p, block.Err)
+				}
+				current = block.Offset
+			}
+
+			offset, err := reset(client, topic, p, current)
+			if err != nil {
+				return nil, fmt.Errorf("[kafka] can't resolve offset topic=%s partition=%d: %w", topic, p, err)
+			}
+			if offset, err = clampOffset(client, topic, p, offset); err != nil {
+				return nil, err
+			}
+			commit.AddBlock(topic, p, offset, 0, sarama.ReceiveTime, "")
+			offsets[topic][p] = offset
+		}
+	}
+
+	resp, err := coordinator.CommitOffset(commit)
+	if err != nil {
+		return nil, fmt.Errorf("[kafka] can't commit offsets of group %s: %w", group, err)
+	}
+	for topic, errs := range resp.Errors {
+		for p, kerr := range errs {
+			if kerr != sarama.ErrNoError {
+				return nil, fmt.Errorf("[kafka] can't commit offset topic=%s partition=%d: %w", topic, p, kerr)
+			}
+		}
+	}
+	return offsets, nil
+}
+
+// checkGroupInactive fails if the group has members, the broker rejects their commits otherwise
+func checkGroupInactive(coordinator *sarama.Broker, group string) error {
+	resp, err := coordinator.DescribeGroups(&sarama.DescribeGroupsRequest{Groups: []string{group}})
+	if err != nil {
+		return fmt.Errorf("[kafka] can't describe group %s: %w", group, err)
+	}
+	for _, g := range resp.Groups {
+		if g.Err != sarama.ErrNoError {
+			return fmt.Errorf("[kafka] can't describe group %s: %w", group, g.Err)
+		}
+		if g.State != "Empty" && g.State != "Dead" {
+			return fmt.Errorf("[kafka] group %s is %s, stop its consumers before resetting offsets", group, g.State)
+		}
+	}
+	return nil
+}
+
+// clampOffset keeps the offset between the oldest and the newest offsets of the partition
+func clampOffset(client sarama.Client, topic string, partition int32, offset int64) (int64, error) {
+	oldest, err := client.GetOffset(topic, partition, sarama.OffsetOldest)
+	if err != nil {
+		return 0, fmt.Errorf("[kafka] can't get oldest offset topic=%s partition=%d: %w", topic, partition, err)
+	}
+	newest, err := client.GetOffset(topic, partition, sarama.OffsetNewest)
+	if err != nil {
+		return 0, fmt.Errorf("[kafka] can't get newest offset topic=%s partition=%d: %w", topic, partition, err)
+	}
+	if offset < oldest {
+		return oldest, nil
+	}
+	if offset > newest {
+		return newest, nil
+	}
+	return offset, nil
+}
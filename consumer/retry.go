@@ -0,0 +1,163 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"kafka/producer"
+)
+
+// Headers added to republished messages, see RetryTopics
+const (
+	HeaderRetryAttempt      = "kafka-retry-attempt"
+	HeaderRetryDue          = "kafka-retry-due"
+	HeaderOriginalTopic     = "kafka-original-topic"
+	HeaderOriginalPartition = "kafka-original-partition"
+	HeaderOriginalOffset    = "kafka-original-offset"
+	HeaderError             = "kafka-error"
+)
+
+// retrier republishes failed messages to the retry topic of the next delay, or to the DLQ after the last one
+type retrier struct {
+	producer *producer.TypedProducer[[]byte]
+	delays   []time.Duration
+	dlq      *deadLetter
+}
+
+// RetryTopics makes messages which failed all Retries attempts go to <topic>.retry.<delay> topics, one per delay
+// (e.g. orders.retry.5s, orders.retry.1m, orders.retry.10m), and to dlq after the last one, "" means <topic>.dlq,
+// see DeadLetter. Key, value and headers are kept, the attempt, due time, error and original position are added
+// as headers. The retry topics are consumed by NewRetryWorker. OnFailure and DeadLetter are not used,
+// the producer is not closed by the worker
+func RetryTopics(p *producer.KafkaProducer, delays []time.Duration, dlq string) Option {
+	return func(o *options) {
+		o.retry = &retrier{
+			producer: producer.NewTyped[[]byte](p, producer.BytesCodec{}),
+			delays:   delays,
+			dlq:      newDeadLetter(p, dlq),
+		}
+	}
+}
+
+// NewRetryWorker consumes the retry topics of Topics set up by RetryTopics, every message is handled once
+// its delay elapses and goes to the next retry topic if it fails again. The group gets a .retry suffix,
+// so it doesn't share partitions with the main worker, the other options are the main worker's ones.
+// Both workers would close DestinationChan, MessageChan and BatchChan, so Run rejects them, use Handler
+// or BatchHandler
+func NewRetryWorker(opts ...Option) *Worker {
+	w := New(opts...)
+	w.retryWorker = true
+	if w.retry == nil {
+		return w
+	}
+
+	topics := make([]string, 0, len(w.topics)*len(w.retry.delays))
+	for _, topic := range w.topics {
+		for _, delay := range w.retry.delays {
+			topics = append(topics, RetryTopic(topic, delay))
+		}
+	}
+	w.topics = topics
+	if w.kafkaGroup != "" {
+		w.kafkaGroup += ".retry"
+	}
+	return w
+}
+
+// RetryTopic returns the retry topic of the topic for the delay, e.g. orders.retry.5s or orders.retry.1h
+func RetryTopic(topic string, delay time.Duration) string {
+	var suffix string
+	switch {
+	case delay%time.Hour == 0:
+		suffix = fmt.Sprintf("%dh", delay/time.Hour)
+	case delay%time.Minute == 0:
+		suffix = fmt.Sprintf("%dm", delay/time.Minute)
+	case delay%time.Second == 0:
+		suffix = fmt.Sprintf("%ds", delay/time.Second)
+	default:
+		suffix = delay.String()
+	}
+	return topic + ".retry." + suffix
+}
+
+// republish is the FailureHandler of RetryTopics, the offset is marked only after the broker acks the copy
+func (r *retrier) republish(ctx context.Context, m Message, err error) error {
+	attempt, _ := strconv.Atoi(headerString(m.ConsumerMessage, HeaderRetryAttempt))
+	origin := headerString(m.ConsumerMessage, HeaderOriginalTopic)
+	if origin == "" {
+		origin = m.Topic
+	}
+
+	attemptHeader := recordHeader(HeaderRetryAttempt, strconv.Itoa(attempt+1))
+	if attempt >= len(r.delays) {
+		return r.dlq.publish(ctx, m, err, attemptHeader)
+	}
+
+	delay := r.delays[attempt]
+	topic := RetryTopic(origin, delay)
+	headers := append(failureHeaders(m, err), attemptHeader,
+		recordHeader(HeaderRetryDue, strconv.FormatInt(time.Now().Add(delay).UnixMilli(), 10)))
+	if _, err := r.producer.SendSyncTo(ctx, topic, string(m.Key), m.Value, headers...); err != nil {
+		return fmt.Errorf("[kafka] can't republish message to %s: %w", topic, err)
+	}
+	return nil
+}
+
+// failureHeaders copies the message headers, the original position is set by the first failure only
+func failureHeaders(m Message, err error) []sarama.RecordHeader {
+	headers := make([]sarama.RecordHeader, 0, len(m.Headers)+6)
+	for _, h := range m.Headers {
+		if h == nil {
+			continue
+		}
+		switch string(h.Key) {
+		case HeaderRetryAttempt, HeaderRetryDue, HeaderError:
+			continue
+		}
+		headers = append(headers, *h)
+	}
+	if headerString(m.ConsumerMessage, HeaderOriginalTopic) == "" {
+		headers = append(headers,
+			recordHeader(HeaderOriginalTopic, m.Topic),
+			recordHeader(HeaderOriginalPartition, strconv.Itoa(int(m.Partition))),
+			recordHeader(HeaderOriginalOffset, strconv.FormatInt(m.Offset, 10)),
+		)
+	}
+	return append(headers, recordHeader(HeaderError, err.Error()))
+}
+
+func headerString(msg *sarama.ConsumerMessage, key string) string {
+	value, _ := Header(msg, key)
+	return string(value)
+}
+
+func recordHeader(key, value string) sarama.RecordHeader {
+	return sarama.RecordHeader{Key: []byte(key), Value: []byte(value)}
+}
+
+// waitDue blocks until the retry due time of the message, false means ctx is done
+func (h *msgHandler) waitDue(ctx context.Context, msg *sarama.ConsumerMessage) bool {
+	if !h.delayed {
+		return true
+	}
+	due, err := strconv.ParseInt(headerString(msg, HeaderRetryDue), 10, 64)
+	if err != nil {
+		return true
+	}
+	wait := time.Until(time.UnixMilli(due))
+	if wait <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,158 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"kafka/producer"
+)
+
+// newCapturingProducer produces to a mock broker leading partition 0 of the topics, copies of the acked
+// messages are sent to the returned channel, their values go back to the pool after the handler
+func newCapturingProducer(t *testing.T, topics ...string) (*producer.KafkaProducer, <-chan *sarama.ProducerMessage) {
+	broker := newTestBroker(t)
+	metadata := sarama.NewMockMetadataResponse(t).SetBroker(broker.Addr(), broker.BrokerID())
+	for _, topic := range topics {
+		metadata.SetLeader(topic, 0, broker.BrokerID())
+	}
+	serve(t, broker, map[string]sarama.MockResponse{
+		"MetadataRequest": metadata,
+		"ProduceRequest":  sarama.NewMockProduceResponse(t).SetVersion(3),
+	})
+
+	acked := make(chan *sarama.ProducerMessage, 16)
+	p, err := producer.NewKafkaProducer([]string{broker.Addr()}, topics[0],
+		producer.KafkaVersion(sarama.V0_11_0_0),
+		producer.SuccessHandler(func(msg *sarama.ProducerMessage) {
+			value, _ := msg.Value.Encode()
+			acked <- &sarama.ProducerMessage{
+				Topic:   msg.Topic,
+				Value:   sarama.ByteEncoder(append([]byte(nil), value...)),
+				Headers: append([]sarama.RecordHeader(nil), msg.Headers...),
+			}
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = p.Close() })
+	return p, acked
+}
+
+func producedHeaders(msg *sarama.ProducerMessage) map[string]string {
+	headers := make(map[string]string, len(msg.Headers))
+	for _, h := range msg.Headers {
+		headers[string(h.Key)] = string(h.Value)
+	}
+	return headers
+}
+
+// consumed turns a produced message into the one consumed from its topic
+func consumed(t *testing.T, msg *sarama.ProducerMessage, offset int64) *sarama.ConsumerMessage {
+	value, err := msg.Value.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := make([]*sarama.RecordHeader, 0, len(msg.Headers))
+	for i := range msg.Headers {
+		headers = append(headers, &msg.Headers[i])
+	}
+	return &sarama.ConsumerMessage{Topic: msg.Topic, Offset: offset, Value: value, Headers: headers}
+}
+
+func TestRetryTopic(t *testing.T) {
+	for delay, want := range map[time.Duration]string{
+		5 * time.Second:         "events.retry.5s",
+		time.Minute:             "events.retry.1m",
+		90 * time.Minute:        "events.retry.90m",
+		2 * time.Hour:           "events.retry.2h",
+		1500 * time.Millisecond: "events.retry.1.5s",
+	} {
+		if got := RetryTopic("events", delay); got != want {
+			t.Errorf("RetryTopic(%v) = %s, want %s", delay, got, want)
+		}
+	}
+}
+
+func TestRetryTopicsRouting(t *testing.T) {
+	p, acked := newCapturingProducer(t, "events", "events.retry.1s", "events.retry.1m", "events.dlq")
+	w := New(Topics([]string{"events"}), Group("billing"), LoggerSet(&testLogger),
+		RetryTopics(p, []time.Duration{time.Second, time.Minute}, ""))
+	ctx := context.Background()
+
+	msg := testMessage(7)
+	for attempt, want := range []string{"events.retry.1s", "events.retry.1m", "events.dlq"} {
+		if err := w.onFailure(ctx, Message{ConsumerMessage: msg}, errors.New("broken")); err != nil {
+			t.Fatal(err)
+		}
+		got := <-acked
+		headers := producedHeaders(got)
+		if got.Topic != want {
+			t.Fatalf("attempt %d went to %s, want %s", attempt+1, got.Topic, want)
+		}
+		if headers[HeaderRetryAttempt] != strconv.Itoa(attempt+1) || headers[HeaderError] != "broken" {
+			t.Fatalf("attempt %d headers %v", attempt+1, headers)
+		}
+		// the first failure is the original position
+		if headers[HeaderOriginalTopic] != "events" || headers[HeaderOriginalOffset] != "7" {
+			t.Fatalf("attempt %d original position %v", attempt+1, headers)
+		}
+		if want == "events.dlq" {
+			if headers[HeaderGroup] != "billing" {
+				t.Fatalf("dead letter headers %v", headers)
+			}
+		} else if _, ok := headers[HeaderRetryDue]; !ok {
+			t.Fatalf("attempt %d has no due time", attempt+1)
+		}
+		msg = consumed(t, got, int64(attempt))
+	}
+}
+
+func TestRetryWaitsForDue(t *testing.T) {
+	h := newMsgHandler(nil, &HandlerConfig{Delayed: true}, &testLogger, nil)
+	due := time.UnixMilli(time.Now().Add(50 * time.Millisecond).UnixMilli())
+	msg := testMessage(0)
+	msg.Headers = []*sarama.RecordHeader{{Key: []byte(HeaderRetryDue), Value: []byte(strconv.FormatInt(due.UnixMilli(), 10))}}
+
+	if !h.waitDue(context.Background(), msg) {
+		t.Fatal("waitDue failed")
+	}
+	if time.Now().Before(due) {
+		t.Fatal("handled before the due time")
+	}
+
+	msg.Headers[0].Value = []byte(strconv.FormatInt(time.Now().Add(time.Hour).UnixMilli(), 10))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if h.waitDue(ctx, msg) {
+		t.Fatal("waitDue ignores the end of the session")
+	}
+}
+
+func TestNewRetryWorker(t *testing.T) {
+	p, _ := newCapturingProducer(t, "events")
+	opts := []Option{Topics([]string{"events", "orders"}), Group("billing"), LoggerSet(&testLogger),
+		RetryTopics(p, []time.Duration{time.Second, time.Minute}, "")}
+
+	w := NewRetryWorker(append(opts, Handler(func(ctx context.Context, msg Message) error { return nil }))...)
+	want := []string{"events.retry.1s", "events.retry.1m", "orders.retry.1s", "orders.retry.1m"}
+	if len(w.topics) != len(want) {
+		t.Fatalf("topics %v, want %v", w.topics, want)
+	}
+	for i := range want {
+		if w.topics[i] != want[i] {
+			t.Fatalf("topics %v, want %v", w.topics, want)
+		}
+	}
+	if w.kafkaGroup != "billing.retry" || w.retry == nil {
+		t.Fatalf("group %s", w.kafkaGroup)
+	}
+
+	shared := NewRetryWorker(append(opts, MessageChan(make(chan *Message)))...)
+	if err := shared.Run(); err == nil {
+		t.Fatal("a channel shared with the main worker is accepted")
+	}
+}
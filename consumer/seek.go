@@ -0,0 +1,144 @@
+package consumer
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// ErrNotRunning is returned by Worker.Seek if Run is not running
+var ErrNotRunning = fmt.Errorf("[kafka] worker is not running")
+
+// positions keeps the partitions this worker has started and the offsets requested by Worker.Seek
+// until the next session claiming them starts
+type positions struct {
+	mu      sync.Mutex
+	session sarama.ConsumerGroupSession
+	seeks   map[string]map[int32]int64
+	started map[string]map[int32]bool
+}
+
+// Seek moves a partition consumed by the worker to the offset, sarama.OffsetOldest and sarama.OffsetNewest
+// are accepted. In a group the session restarts to apply it (the offset is committed with KeepOffset), so it works
+// only for partitions claimed by this worker and messages not acked yet are delivered again
+func (w *Worker) Seek(topic string, partition int32, offset int64) error {
+	consumer := w.current()
+	if consumer == nil {
+		return ErrNotRunning
+	}
+	return consumer.seek(topic, partition, offset)
+}
+
+// SeekToTimestamp seeks to the first offset with a timestamp at or after ts, or to the end of the partition
+func (w *Worker) SeekToTimestamp(topic string, partition int32, ts time.Time) error {
+	offset, err := offsetForTime(w.client, topic, partition, ts.UnixMilli())
+	if err != nil {
+		return fmt.Errorf("[kafka] can't resolve offset topic=%s partition=%d: %w", topic, partition, err)
+	}
+	return w.Seek(topic, partition, offset)
+}
+
+// startSession moves the claims of a new session: a requested seek wins, a partition claimed by this
+// worker for the first time starts at readSince. Claims start from the session's offsets, so marking
+// before ConsumeClaim is a seek. Without KeepOffset auto-commit is disabled and the marks aren't committed
+func (h *consumerHandler) startSession(session sarama.ConsumerGroupSession) {
+	p := &h.positions
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.session = session
+	for topic, partitions := range session.Claims() {
+		for _, partition := range partitions {
+			if offset, ok := p.seeks[topic][partition]; ok {
+				// ResetOffset moves back only and MarkOffset forward only
+				session.ResetOffset(topic, partition, offset, "")
+				session.MarkOffset(topic, partition, offset, "")
+			} else if !p.started[topic][partition] {
+				h.seekSince(session, topic, partition)
+			}
+
+			if p.started == nil {
+				p.started = make(map[string]map[int32]bool)
+			}
+			if p.started[topic] == nil {
+				p.started[topic] = make(map[int32]bool)
+			}
+			p.started[topic][partition] = true
+		}
+	}
+	// seeks of partitions which went to other members are dropped
+	p.seeks = nil
+}
+
+func (h *consumerHandler) endSession() {
+	h.positions.mu.Lock()
+	h.positions.session = nil
+	h.positions.mu.Unlock()
+}
+
+// claims are the partitions of the current session, nil between sessions
+func (h *consumerHandler) claims() map[string][]int32 {
+	h.positions.mu.Lock()
+	defer h.positions.mu.Unlock()
+	if h.positions.session == nil {
+		return nil
+	}
+	return h.positions.session.Claims()
+}
+
+// requestSeek keeps the seek until the next session, the partition must be claimed by the current one
+func (h *consumerHandler) requestSeek(topic string, partition int32, offset int64) error {
+	p := &h.positions
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.session == nil || !claimed(p.session.Claims(), topic, partition) {
+		return fmt.Errorf("[kafka] topic=%s partition=%d is not claimed by the worker", topic, partition)
+	}
+	if p.seeks == nil {
+		p.seeks = make(map[string]map[int32]int64)
+	}
+	if p.seeks[topic] == nil {
+		p.seeks[topic] = make(map[int32]int64)
+	}
+	p.seeks[topic][partition] = offset
+	return nil
+}
+
+// seekSince moves the partition to the first offset at or after readSince if it's set,
+// MarkOffset never moves back, so a committed offset past it is kept
+func (h *consumerHandler) seekSince(session sarama.ConsumerGroupSession, topic string, partition int32) {
+	readSince := h.msgHandler.readSince
+	if readSince.IsZero() {
+		return
+	}
+	offset, err := offsetForTime(h.client, topic, partition, readSince.UnixMilli())
+	if err != nil {
+		h.logger.Err(err).Msgf("[kafka] can't resolve read since offset topic=%s partition=%d", topic, partition)
+		return
+	}
+	session.MarkOffset(topic, partition, offset, "")
+}
+
+// offsetForTime returns the first offset with timestamp >= ts, or the high water mark if there is none
+func offsetForTime(client sarama.Client, topic string, partition int32, ts int64) (int64, error) {
+	offset, err := client.GetOffset(topic, partition, ts)
+	if err != nil {
+		return 0, err
+	}
+	if offset == sarama.OffsetNewest {
+		return client.GetOffset(topic, partition, sarama.OffsetNewest)
+	}
+	return offset, nil
+}
+
+func claimed(claims map[string][]int32, topic string, partition int32) bool {
+	for _, p := range claims[topic] {
+		if p == partition {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+package consumer
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+func TestReadSinceDefault(t *testing.T) {
+	readSince := New().readSince
+	if want := time.Now().Add(-60 * time.Hour); readSince.Before(want.Add(-time.Minute)) || readSince.After(want) {
+		t.Fatalf("default read since %v, want about %v", readSince, want)
+	}
+}
+
+func TestReadSinceStartsAtBrokerOffset(t *testing.T) {
+	since := time.Now().Add(-time.Hour)
+	client := newTestClient(t, map[string]sarama.MockResponse{
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).SetOffset("events", 0, since.UnixMilli(), 42),
+	})
+	h := newTestHandler(&HandlerConfig{ReadSince: since}, nil)
+	h.client = client
+	session := newTestSession(context.Background())
+
+	h.startSession(session)
+	if want := []int64{42}; !reflect.DeepEqual(session.marked, want) {
+		t.Fatalf("marked %v, want %v", session.marked, want)
+	}
+
+	// the partition keeps its position in the next sessions of the worker
+	next := newTestSession(context.Background())
+	h.startSession(next)
+	if len(next.marked) != 0 {
+		t.Fatalf("marked %v again", next.marked)
+	}
+}
+
+func TestSeekAppliedByNextSession(t *testing.T) {
+	h := newTestHandler(&HandlerConfig{}, nil)
+	if err := h.requestSeek("events", 0, 7); err == nil {
+		t.Fatal("seek without a session is accepted")
+	}
+	h.startSession(newTestSession(context.Background()))
+	if err := h.requestSeek("events", 1, 7); err == nil {
+		t.Fatal("seek of an unclaimed partition is accepted")
+	}
+	if err := h.requestSeek("events", 0, 7); err != nil {
+		t.Fatal(err)
+	}
+	h.endSession()
+
+	next := newTestSession(context.Background())
+	h.startSession(next)
+	if !reflect.DeepEqual(next.resets, []int64{7}) || !reflect.DeepEqual(next.marked, []int64{7}) {
+		t.Fatalf("resets %v and marks %v, want 7", next.resets, next.marked)
+	}
+
+	// applied once
+	last := newTestSession(context.Background())
+	h.startSession(last)
+	if len(last.resets) != 0 || len(last.marked) != 0 {
+		t.Fatalf("seek applied again: resets %v marks %v", last.resets, last.marked)
+	}
+}
+
+func TestSeekNotRunning(t *testing.T) {
+	if err := New().Seek("events", 0, 0); err != ErrNotRunning {
+		t.Fatalf("got %v, want ErrNotRunning", err)
+	}
+}
+
+func TestSeekStandalone(t *testing.T) {
+	offsets := make(chan int64, 16)
+	stop := make(chan struct{})
+	w, result := runWorker(t, stop,
+		Client(newFetchClient(t, 3)),
+		Topics([]string{"events"}),
+		StartOffset(sarama.OffsetOldest),
+		PartitionRefresh(0),
+		Handler(func(ctx context.Context, msg Message) error {
+			offsets <- msg.Offset
+			return nil
+		}),
+	)
+	defer waitRun(t, result)
+	defer close(stop)
+
+	for want := int64(0); want < 3; want++ {
+		if got := receiveOffset(t, offsets); got != want {
+			t.Fatalf("consumed %d, want %d", got, want)
+		}
+	}
+	if err := w.Seek("events", 0, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := receiveOffset(t, offsets); got != 1 {
+		t.Fatalf("consumed %d after the seek, want 1", got)
+	}
+}
+
+func receiveOffset(t *testing.T, offsets <-chan int64) int64 {
+	t.Helper()
+	select {
+	case offset := <-offsets:
+		return offset
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing consumed")
+		return 0
+	}
+}
+
+func TestResetGroupOffsets(t *testing.T) {
+	broker := newTestBroker(t)
+	serve(t, broker, map[string]sarama.MockResponse{
+		"FindCoordinatorRequest": sarama.NewMockFindCoordinatorResponse(t).SetCoordinator(sarama.CoordinatorGroup, "billing", broker),
+		"DescribeGroupsRequest": sarama.NewMockDescribeGroupsResponse(t).
+			AddGroupDescription("billing", &sarama.GroupDescription{GroupId: "billing", State: "Empty"}),
+		"OffsetFetchRequest":  sarama.NewMockOffsetFetchResponse(t).SetOffset("billing", "events", 0, 5, "", sarama.ErrNoError),
+		"OffsetCommitRequest": sarama.NewMockOffsetCommitResponse(t),
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).
+			SetOffset("events", 0, sarama.OffsetOldest, 2).
+			SetOffset("events", 0, sarama.OffsetNewest, 10),
+	})
+	client := connectTestClient(t, broker)
+
+	for _, tt := range []struct {
+		name  string
+		reset OffsetReset
+		want  int64
+	}{
+		{"earliest", ToEarliest(), 2},
+		{"latest", ToLatest(), 10},
+		{"back", ShiftBy(-2), 3},
+		{"clamped", ShiftBy(-10), 2},
+		{"past the end", ShiftBy(10), 10},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			offsets, err := ResetGroupOffsets(client, "billing", []string{"events"}, tt.reset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := offsets["events"][0]; got != tt.want {
+				t.Fatalf("reset to %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResetGroupOffsetsActiveGroup(t *testing.T) {
+	broker := newTestBroker(t)
+	serve(t, broker, map[string]sarama.MockResponse{
+		"FindCoordinatorRequest": sarama.NewMockFindCoordinatorResponse(t).SetCoordinator(sarama.CoordinatorGroup, "billing", broker),
+		"DescribeGroupsRequest": sarama.NewMockDescribeGroupsResponse(t).
+			AddGroupDescription("billing", &sarama.GroupDescription{GroupId: "billing", State: "Stable"}),
+	})
+	_, err := ResetGroupOffsets(connectTestClient(t, broker), "billing", []string{"events"}, ToEarliest())
+	if err == nil || !strings.Contains(err.Error(), "Stable") {
+		t.Fatalf("got %v, want the active group rejected", err)
+	}
+}
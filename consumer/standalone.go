@@ -0,0 +1,301 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// standalone consumes partitions without a consumer group, so offsets are never committed.
+// Every partition is passed to consumerHandler.ConsumeClaim as a claim of a session that lasts until ctx is done
+type standalone struct {
+	client     sarama.Client
+	consumer   sarama.Consumer
+	handler    *consumerHandler
+	logger     logger
+	topics     []string
+	partitions map[string][]int32
+	refresh    time.Duration
+
+	startOffset    int64
+	hasStartOffset bool
+
+	session *standaloneSession
+	// startMu serializes starting, seeking and closing partition consumers
+	startMu sync.Mutex
+	closed  bool
+	mu      sync.Mutex
+	claims  map[string]map[int32]*standalonePartition
+	// done is closed when run returns, no partition is started by run after that
+	done chan struct{}
+}
+
+// standalonePartition is a running claim, done waits for its goroutines
+type standalonePartition struct {
+	pc   sarama.PartitionConsumer
+	done sync.WaitGroup
+}
+
+func newStandalone(w *Worker, handler *consumerHandler) (*standalone, error) {
+	consumer, err := sarama.NewConsumerFromClient(w.client)
+	if err != nil {
+		return nil, err
+	}
+	s := &standalone{
+		client:         w.client,
+		consumer:       consumer,
+		handler:        handler,
+		logger:         w.logger,
+		topics:         w.topics,
+		partitions:     w.partitions,
+		refresh:        w.partitionRefresh,
+		startOffset:    w.startOffset,
+		hasStartOffset: w.hasStartOffset,
+		claims:         make(map[string]map[int32]*standalonePartition),
+		done:           make(chan struct{}),
+	}
+	s.session = &standaloneSession{claims: s.claimed}
+	return s, nil
+}
+
+// run starts the selected partitions and then checks for new ones every refresh interval,
+// partitions added later are consumed from the oldest offset so nothing written to them is missed
+func (s *standalone) run(ctx context.Context, errCh chan<- error) {
+	defer close(s.done)
+
+	s.session.ctx = ctx
+	if err := s.claim(s.initialOffset); err != nil {
+		s.logger.Err(err).Msg("[kafka] can't start partition consumers")
+		select {
+		case errCh <- err:
+		case <-ctx.Done():
+		}
+		return
+	}
+	if s.refresh <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.refresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.client.RefreshMetadata(s.topics...); err != nil {
+				s.logger.Err(err).Msg("[kafka] can't refresh metadata")
+				continue
+			}
+			if err := s.claim(s.oldestOffset); err != nil {
+				s.logger.Err(err).Msg("[kafka] can't start new partition consumers")
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// claim starts consuming the selected partitions which are not consumed yet
+func (s *standalone) claim(offsetOf func(topic string, partition int32) (int64, error)) error {
+	s.startMu.Lock()
+	defer s.startMu.Unlock()
+
+	started := make(map[string][]int32)
+	defer func() {
+		if len(started) > 0 && s.handler.onAssigned != nil {
+			s.handler.onAssigned(s.session, started)
+		}
+	}()
+
+	for _, topic := range s.topics {
+		partitions, err := s.selected(topic)
+		if err != nil {
+			return fmt.Errorf("[kafka] can't get partitions of %s: %w", topic, err)
+		}
+		for _, partition := range partitions {
+			if s.get(topic, partition) != nil {
+				continue
+			}
+			offset, err := offsetOf(topic, partition)
+			if err != nil {
+				return fmt.Errorf("[kafka] can't resolve start offset topic=%s partition=%d: %w", topic, partition, err)
+			}
+			if err := s.start(topic, partition, offset); err != nil {
+				return err
+			}
+			started[topic] = append(started[topic], partition)
+		}
+	}
+	return nil
+}
+
+// seek restarts the partition consumer at the offset
+func (s *standalone) seek(topic string, partition int32, offset int64) error {
+	s.startMu.Lock()
+	defer s.startMu.Unlock()
+
+	if s.closed {
+		return ErrNotRunning
+	}
+	p := s.get(topic, partition)
+	if p == nil {
+		return fmt.Errorf("[kafka] topic=%s partition=%d is not consumed by the worker", topic, partition)
+	}
+	// the partition can be consumed again only after the previous consumer is gone
+	p.pc.AsyncClose()
+	p.done.Wait()
+	return s.start(topic, partition, offset)
+}
+
+func (s *standalone) start(topic string, partition int32, offset int64) error {
+	pc, err := s.consumer.ConsumePartition(topic, partition, offset)
+	if err != nil {
+		return fmt.Errorf("[kafka] can't consume topic=%s partition=%d offset=%d: %w", topic, partition, offset, err)
+	}
+	p := &standalonePartition{pc: pc}
+	s.add(topic, partition, p)
+
+	p.done.Add(2)
+	go s.logErrors(p)
+	go s.consume(p, &partitionClaim{PartitionConsumer: pc, topic: topic, partition: partition, offset: offset})
+	return nil
+}
+
+// selected returns the existing partitions of the topic, filtered by Partitions if it's set for the topic
+func (s *standalone) selected(topic string) ([]int32, error) {
+	all, err := s.client.Partitions(topic)
+	if err != nil {
+		return nil, err
+	}
+	wanted, ok := s.partitions[topic]
+	if !ok {
+		return all, nil
+	}
+
+	exist := make(map[int32]bool, len(all))
+	for _, p := range all {
+		exist[p] = true
+	}
+	partitions := make([]int32, 0, len(wanted))
+	for _, p := range wanted {
+		// a selected partition which doesn't exist yet is picked up once it's created
+		if exist[p] {
+			partitions = append(partitions, p)
+		}
+	}
+	return partitions, nil
+}
+
+// initialOffset is StartOffset if it's set, otherwise the first offset after ReadSince or the oldest one
+func (s *standalone) initialOffset(topic string, partition int32) (int64, error) {
+	if s.hasStartOffset {
+		return s.startOffset, nil
+	}
+	if readSince := s.handler.msgHandler.readSince; !readSince.IsZero() {
+		return offsetForTime(s.client, topic, partition, readSince.UnixMilli())
+	}
+	return sarama.OffsetOldest, nil
+}
+
+func (s *standalone) oldestOffset(string, int32) (int64, error) {
+	return sarama.OffsetOldest, nil
+}
+
+func (s *standalone) consume(p *standalonePartition, claim *partitionClaim) {
+	defer p.done.Done()
+	if err := s.handler.ConsumeClaim(s.session, claim); err != nil {
+		s.logger.Err(err).Msgf("[kafka] failed to consume topic=%s partition=%d", claim.topic, claim.partition)
+	}
+}
+
+func (s *standalone) logErrors(p *standalonePartition) {
+	defer p.done.Done()
+	for err := range p.pc.Errors() {
+		s.logger.Err(err).Msg("[kafka] consumer error")
+	}
+}
+
+func (s *standalone) add(topic string, partition int32, p *standalonePartition) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.claims[topic] == nil {
+		s.claims[topic] = make(map[int32]*standalonePartition)
+	}
+	s.claims[topic][partition] = p
+}
+
+func (s *standalone) get(topic string, partition int32) *standalonePartition {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.claims[topic][partition]
+}
+
+func (s *standalone) claimed() map[string][]int32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	claims := make(map[string][]int32, len(s.claims))
+	for topic, partitions := range s.claims {
+		for p := range partitions {
+			claims[topic] = append(claims[topic], p)
+		}
+	}
+	return claims
+}
+
+// Close stops the partition consumers and waits for their claims, ctx of run must be done first
+func (s *standalone) Close() error {
+	<-s.done
+	s.startMu.Lock()
+	defer s.startMu.Unlock()
+	s.closed = true
+
+	// claims aren't changed without startMu
+	for _, partitions := range s.claims {
+		for _, p := range partitions {
+			p.pc.AsyncClose()
+		}
+	}
+	for _, partitions := range s.claims {
+		for _, p := range partitions {
+			p.done.Wait()
+		}
+	}
+	if claims := s.claimed(); len(claims) > 0 && s.handler.onRevoked != nil {
+		s.handler.onRevoked(s.session, claims)
+	}
+	return s.consumer.Close()
+}
+
+func (s *standalone) Pause(partitions map[string][]int32)  { s.consumer.Pause(partitions) }
+func (s *standalone) Resume(partitions map[string][]int32) { s.consumer.Resume(partitions) }
+func (s *standalone) PauseAll()                            { s.consumer.PauseAll() }
+func (s *standalone) ResumeAll()                           { s.consumer.ResumeAll() }
+
+// partitionClaim adapts a partition consumer to sarama.ConsumerGroupClaim
+type partitionClaim struct {
+	sarama.PartitionConsumer
+	topic     string
+	partition int32
+	offset    int64
+}
+
+func (c *partitionClaim) Topic() string        { return c.topic }
+func (c *partitionClaim) Partition() int32     { return c.partition }
+func (c *partitionClaim) InitialOffset() int64 { return c.offset }
+
+// standaloneSession is a sarama.ConsumerGroupSession without a group, there is nothing to commit
+type standaloneSession struct {
+	ctx    context.Context
+	claims func() map[string][]int32
+}
+
+func (s *standaloneSession) Claims() map[string][]int32                  { return s.claims() }
+func (s *standaloneSession) MemberID() string                            { return "" }
+func (s *standaloneSession) GenerationID() int32                         { return 0 }
+func (s *standaloneSession) MarkOffset(string, int32, int64, string)     {}
+func (s *standaloneSession) Commit()                                     {}
+func (s *standaloneSession) ResetOffset(string, int32, int64, string)    {}
+func (s *standaloneSession) MarkMessage(*sarama.ConsumerMessage, string) {}
+func (s *standaloneSession) Context() context.Context                    { return s.ctx }
@@ -0,0 +1,85 @@
+package consumer
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// newFetchClient serves offsets 0..n-1 of events/0
+func newFetchClient(t *testing.T, n int64) sarama.Client {
+	fetch := sarama.NewMockFetchResponse(t, 1)
+	for offset := int64(0); offset < n; offset++ {
+		fetch.SetMessage("events", 0, offset, sarama.StringEncoder("value"))
+	}
+	fetch.SetHighWaterMark("events", 0, n)
+	return newTestClient(t, map[string]sarama.MockResponse{
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).
+			SetOffset("events", 0, sarama.OffsetOldest, 0).
+			SetOffset("events", 0, sarama.OffsetNewest, n),
+		"FetchRequest": fetch,
+	})
+}
+
+// runWorker runs the worker until stop is closed, the returned channel gets the result of Run
+func runWorker(t *testing.T, stop <-chan struct{}, opts ...Option) (*Worker, <-chan error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := New(append(opts, Context(ctx), LoggerSet(&testLogger))...)
+	result := make(chan error, 1)
+	go func() { result <- w.Run() }()
+	go func() {
+		<-stop
+		cancel()
+	}()
+	t.Cleanup(cancel)
+	return w, result
+}
+
+func waitRun(t *testing.T, result <-chan error) {
+	t.Helper()
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run didn't return")
+	}
+}
+
+func TestStandaloneConsumesWithoutGroup(t *testing.T) {
+	var mu sync.Mutex
+	var offsets []int64
+	stop := make(chan struct{})
+	_, result := runWorker(t, stop,
+		Client(newFetchClient(t, 3)),
+		Topics([]string{"events"}),
+		StartOffset(sarama.OffsetOldest),
+		PartitionRefresh(0),
+		Handler(func(ctx context.Context, msg Message) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if offsets = append(offsets, msg.Offset); len(offsets) == 3 {
+				close(stop)
+			}
+			return nil
+		}),
+	)
+
+	waitRun(t, result)
+	if want := []int64{0, 1, 2}; !reflect.DeepEqual(offsets, want) {
+		t.Fatalf("consumed %v, want %v", offsets, want)
+	}
+}
+
+func TestStandaloneRejectsKeepOffset(t *testing.T) {
+	w := New(Topics([]string{"events"}), KeepOffset(true), LoggerSet(&testLogger),
+		Handler(func(ctx context.Context, msg Message) error { return nil }))
+	if err := w.Run(); err == nil {
+		t.Fatal("KeepOffset without a group is accepted")
+	}
+}
@@ -5,11 +5,11 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/Shopify/sarama"
-	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
 )
 
@@ -18,13 +18,25 @@ const cancelTimeout = time.Second * 50
 type Worker struct {
 	logger     logger
 	ctx        context.Context
+	cancel     context.CancelFunc
+	running    sync.WaitGroup
 	client     sarama.Client
 	topics     []string
 	kafkaGroup string
 	batchSize  int
 	readSince  time.Time
+	// filterByTime skips messages by payload time, see FilterByTime
+	filterByTime bool
+
+	// group-less mode, see Partitions, StartOffset and PartitionRefresh
+	partitions       map[string][]int32
+	partitionRefresh time.Duration
+	startOffset      int64
+	hasStartOffset   bool
 
 	destination chan *KafkaMsg
+	messages    chan *Message
+	batches     chan *Batch
 
 	// use a consumer as a consumer group (brokers keep offset for each consumer group)
 	keepOffset bool
@@ -32,78 +44,189 @@ type Worker struct {
 	shutdownCh chan os.Signal
 
 	builder msgBuilder
+
+	// consumer is set while Run is running, see Seek and Pause
+	mu       sync.Mutex
+	consumer consumerLoop
+	// paused by Pause and PauseAll, AutoPause keeps them paused
+	paused    map[string]map[int32]bool
+	pausedAll bool
+
+	handler         HandlerFunc
+	batchHandler    BatchHandlerFunc
+	batchLinger     time.Duration
+	handlerTimeout  time.Duration
+	handlerAttempts int
+	handlerBackoff  time.Duration
+	onFailure       FailureHandler
+
+	onAssigned RebalanceHandler
+	onRevoked  RebalanceHandler
+	strategies []sarama.BalanceStrategy
+
+	// retry republishes failed messages, see RetryTopics
+	retry *retrier
+	// retryWorker is set by NewRetryWorker, its channels would be the main worker's ones
+	retryWorker bool
+
+	concurrency int
+
+	pauseHigh int
+	pauseLow  int
+
+	lagInterval time.Duration
 }
 
 func New(opts ...Option) *Worker {
 
 	log := zerolog.New(zerolog.NewConsoleWriter())
 	o := &options{
-		batchSize:       10000,
-		topics:          []string{"producer-category-table-testing", "producer-image-table-testing", "producer-product-table-testing"},
-		kafkaGroup:      "",
-		readSince:       time.Now().Add(time.Hour * 60 * -1),
-		ctx:             context.Background(),
-		logger:          &log,
-		shutdownSignals: []os.Signal{syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT},
+		batchSize:        10000,
+		topics:           []string{"producer-category-table-testing", "producer-image-table-testing", "producer-product-table-testing"},
+		kafkaGroup:       "",
+		readSince:        time.Now().Add(time.Hour * 60 * -1),
+		ctx:              context.Background(),
+		logger:           &log,
+		shutdownSignals:  []os.Signal{syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT},
+		handlerAttempts:  3,
+		handlerBackoff:   time.Second,
+		batchLinger:      time.Second,
+		partitionRefresh: time.Minute,
 	}
 
 	for _, opt := range opts {
 		opt(o)
 	}
 
+	switch {
+	case o.retry != nil:
+		o.retry.dlq.group = o.kafkaGroup
+		o.onFailure = o.retry.republish
+	case o.dlq != nil:
+		o.dlq.group = o.kafkaGroup
+		o.onFailure = o.dlq.failed
+	}
+
+	ctx, cancel := context.WithCancel(o.ctx)
 	return &Worker{
-		topics:      o.topics,
-		logger:      o.logger,
-		ctx:         o.ctx,
-		client:      o.client,
-		kafkaGroup:  o.kafkaGroup,
-		batchSize:   o.batchSize,
-		readSince:   o.readSince,
-		destination: o.dest,
-		osSignals:   o.shutdownSignals,
-		builder:     o.builderFn,
-		shutdownCh:  make(chan os.Signal),
+		topics:       o.topics,
+		logger:       o.logger,
+		ctx:          ctx,
+		cancel:       cancel,
+		client:       o.client,
+		kafkaGroup:   o.kafkaGroup,
+		batchSize:    o.batchSize,
+		readSince:    o.readSince,
+		filterByTime: o.filterByTime,
+		destination:  o.dest,
+		messages:     o.messages,
+		batches:      o.batches,
+		keepOffset:   o.keepOffset,
+		osSignals:    o.shutdownSignals,
+		builder:      o.builderFn,
+		shutdownCh:   make(chan os.Signal, 1),
+
+		partitions:       o.partitions,
+		partitionRefresh: o.partitionRefresh,
+		startOffset:      o.startOffset,
+		hasStartOffset:   o.hasStartOffset,
+
+		handler:         o.handler,
+		batchHandler:    o.batchHandler,
+		batchLinger:     o.batchLinger,
+		handlerTimeout:  o.handlerTimeout,
+		handlerAttempts: o.handlerAttempts,
+		handlerBackoff:  o.handlerBackoff,
+		onFailure:       o.onFailure,
+
+		onAssigned: o.onAssigned,
+		onRevoked:  o.onRevoked,
+		strategies: o.strategies,
+		retry:      o.retry,
+
+		concurrency: o.concurrency,
+
+		pauseHigh: o.pauseHigh,
+		pauseLow:  o.pauseLow,
+
+		lagInterval: o.lagInterval,
 	}
 }
 
 func (w *Worker) Run() error {
-	consumer, err := sarama.NewConsumerGroupFromClient(w.kafkaGroup, w.client)
-	if err != nil {
-		w.logger.Err(err).Msg("[kafka] can't create consumer group client")
-		return fmt.Errorf("[kafka] can't create consumer group client")
+	w.running.Add(1)
+	defer w.running.Done()
+
+	if w.destination == nil && !w.rawMode() {
+		return fmt.Errorf("[kafka] neither Handler, BatchHandler, MessageChan, BatchChan nor DestinationChan is set")
+	}
+	if !w.rawMode() && w.builder == nil {
+		return fmt.Errorf("[kafka] BuilderFn is required with DestinationChan")
+	}
+	if w.retryWorker && (w.destination != nil || w.messages != nil || w.batches != nil) {
+		return fmt.Errorf("[kafka] retry worker can't share DestinationChan, MessageChan or BatchChan, use Handler or BatchHandler")
+	}
+	if w.pauseHigh > 0 && w.pauseLow >= w.pauseHigh {
+		return fmt.Errorf("[kafka] AutoPause low must be less than high")
+	}
+	if w.pauseHigh > 0 && (w.handler != nil || w.batchHandler != nil) {
+		return fmt.Errorf("[kafka] AutoPause requires DestinationChan, MessageChan or BatchChan")
+	}
+	if w.pauseHigh > 0 && !w.rawMode() && cap(w.destination) <= w.pauseHigh {
+		return fmt.Errorf("[kafka] AutoPause requires DestinationChan buffered for more than high messages")
+	}
+	if w.concurrency > 1 && w.handler == nil {
+		return fmt.Errorf("[kafka] Concurrency requires Handler")
+	}
+	if w.kafkaGroup == "" && w.keepOffset {
+		return fmt.Errorf("[kafka] KeepOffset requires a Group")
 	}
 
 	conf := &HandlerConfig{
-		BatchSize: w.batchSize,
-		ReadSince: w.readSince,
+		BatchSize:    w.batchSize,
+		ReadSince:    w.readSince,
+		FilterByTime: w.filterByTime,
+		Messages:     w.messages,
+		Handler:      w.handler,
+		BatchHandler: w.batchHandler,
+		Batches:      w.batches,
+		Linger:       w.batchLinger,
+		Timeout:      w.handlerTimeout,
+		Attempts:     w.handlerAttempts,
+		Backoff:      w.handlerBackoff,
+		OnFailure:    w.onFailure,
+		Delayed:      w.retry != nil,
 	}
 
 	handler := newMsgHandler(w.destination, conf, w.logger, w.builder)
-	consHandler := newConsumerHandler(handler, w.keepOffset, w.logger)
+	consHandler := newConsumerHandler(handler, w.client, w.keepOffset, w.logger)
+	consHandler.onAssigned, consHandler.onRevoked = w.onAssigned, w.onRevoked
+	consHandler.concurrency = w.concurrency
+	if w.lagInterval > 0 && !w.keepOffset {
+		consHandler.consumed = &consumedOffsets{}
+	}
+
+	consumer, err := w.newConsumer(consHandler)
 	if err != nil {
-		w.logger.Err(err).Msg("[kafka] failed to consume partition")
+		w.logger.Err(err).Msg("[kafka] can't create consumer")
+		return fmt.Errorf("[kafka] can't create consumer: %w", err)
 	}
 
+	w.setConsumer(consumer)
+	defer w.setConsumer(nil)
+
 	// context for every connect/event consumption
 	ctx, cancel := context.WithCancel(w.ctx)
 	errCh := make(chan error)
-	go func(errCh chan error) {
-		for {
-			select {
-			case err, ok := <-consumer.Errors():
-				if !ok {
-					continue
-				}
-				w.logger.Err(err).Msg("[kafka] consumer error")
-				Instance().TotalDuration.With(prometheus.Labels{"reason": err.Error(), "step": "consumer error"})
-			default:
-				if err := consumer.Consume(ctx, w.topics, consHandler); err != nil {
-					w.logger.Err(err).Msg("[kafka] error during Consuming")
-					errCh <- err
-				}
-			}
-		}
-	}(errCh)
+	go consumer.run(ctx, errCh)
+	if w.pauseHigh > 0 {
+		go w.flowControl(ctx, handler, consumer)
+	}
+	if w.lagInterval > 0 {
+		lag := NewLagCollector(w.client, map[string][]string{w.kafkaGroup: w.topics}, w.lagInterval, w.logger)
+		lag.claims, lag.consumed = consumer.claimed, consHandler.consumed
+		go lag.Run(ctx)
+	}
 
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, w.osSignals...)
@@ -126,9 +249,8 @@ func (w *Worker) Run() error {
 	done := make(chan struct{})
 	go func() {
 		cancel()
-		go func() {
-			_ = consumer.Close()
-		}()
+		// the session has to be finished before the queue is closed, otherwise ConsumeClaim may write to it
+		_ = consumer.Close()
 		handler.closeQueue()
 		done <- struct{}{}
 	}()
@@ -142,3 +264,35 @@ func (w *Worker) Run() error {
 		return fmt.Errorf("[kafka] cancelTimeout error")
 	}
 }
+
+// Close stops a running worker and waits until Run returns, the client is not closed
+func (w *Worker) Close() error {
+	w.cancel()
+	w.running.Wait()
+	return nil
+}
+
+func (w *Worker) setConsumer(consumer consumerLoop) {
+	w.mu.Lock()
+	w.consumer = consumer
+	w.mu.Unlock()
+}
+
+func (w *Worker) current() consumerLoop {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.consumer
+}
+
+// newConsumer returns a group-less consumer if Group is not set
+func (w *Worker) newConsumer(handler *consumerHandler) (consumerLoop, error) {
+	if w.kafkaGroup == "" {
+		return newStandalone(w, handler)
+	}
+	return newGroupConsumer(w, handler)
+}
+
+// rawMode is true when messages are delivered as Message, so BuilderFn is optional
+func (w *Worker) rawMode() bool {
+	return w.handler != nil || w.batchHandler != nil || w.messages != nil || w.batches != nil
+}
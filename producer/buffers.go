@@ -5,18 +5,39 @@ import (
 	"sync"
 )
 
+// buffers larger than that are left to GC, so a single huge message doesn't pin memory in the pool
+const maxPooledBufferSize = 1 << 20
+
 // used for better performance by reducing the GC workload
 var buffers = sync.Pool{
 	New: func() interface{} {
-		return &bytes.Buffer{}
+		return &pooledBuffer{}
 	},
 }
 
-func acquireBuffer() *bytes.Buffer {
-	return buffers.Get().(*bytes.Buffer)
+// pooledBuffer is an encoded message value, it implements sarama.Encoder without copying the bytes.
+// The message owns the buffer until its result is handled by the message processor, only then
+// it goes back to the pool, so sarama never reads memory reused by another message
+type pooledBuffer struct {
+	bytes.Buffer
+}
+
+func (b *pooledBuffer) Encode() ([]byte, error) {
+	return b.Bytes(), nil
+}
+
+func (b *pooledBuffer) Length() int {
+	return b.Len()
+}
+
+func acquireBuffer() *pooledBuffer {
+	return buffers.Get().(*pooledBuffer)
 }
 
-func releaseBuffer(buff *bytes.Buffer) {
+func releaseBuffer(buff *pooledBuffer) {
+	if buff.Cap() > maxPooledBufferSize {
+		return
+	}
 	buff.Reset()
 	buffers.Put(buff)
 }
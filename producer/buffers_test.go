@@ -0,0 +1,143 @@
+package producer
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Shopify/sarama"
+)
+
+type stressMsg struct {
+	ID   int
+	Body string
+}
+
+func newStressMsg(id int) stressMsg {
+	return stressMsg{ID: id, Body: strings.Repeat(strconv.Itoa(id%10), 64+id%512)}
+}
+
+func encoded(t testing.TB, v interface{}) []byte {
+	var buf bytes.Buffer
+	if err := json(v, &buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// TestPooledBuffersUnderLoad checks that every value buffer still holds its own payload when its result
+// is handled, while other goroutines keep taking buffers from the pool and overwriting them. With -race
+// a buffer released before sarama is done with it is also reported as a data race
+func TestPooledBuffersUnderLoad(t *testing.T) {
+	broker := newMockBroker(t, sarama.NewMockProduceResponse(t).SetVersion(3))
+	defer broker.Close()
+
+	var (
+		mu      sync.Mutex
+		handled int
+		corrupt []int
+	)
+	check := func(msg *sarama.ProducerMessage) {
+		want := encoded(t, metadataOf(msg).value)
+		got, _ := msg.Value.Encode()
+		mu.Lock()
+		defer mu.Unlock()
+		handled++
+		if !bytes.Equal(got, want) {
+			corrupt = append(corrupt, metadataOf(msg).value.(stressMsg).ID)
+		}
+	}
+	p, err := NewKafkaProducer([]string{broker.Addr()}, "events", KafkaVersion(sarama.V0_11_0_0),
+		SuccessHandler(check), FlushMessages(16))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stop := make(chan struct{})
+	var scribblers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		scribblers.Add(1)
+		go func() {
+			defer scribblers.Done()
+			garbage := bytes.Repeat([]byte{'x'}, 1024)
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				buf := acquireBuffer()
+				buf.Write(garbage)
+				releaseBuffer(buf)
+			}
+		}()
+	}
+
+	const senders, perSender = 16, 100
+	var wg sync.WaitGroup
+	errs := make(chan error, senders*perSender)
+	for s := 0; s < senders; s++ {
+		wg.Add(1)
+		go func(s int) {
+			defer wg.Done()
+			futures := make([]*Future, 0, perSender)
+			for i := 0; i < perSender; i++ {
+				f, err := p.SendAsync(context.Background(), strconv.Itoa(i), newStressMsg(s*perSender+i))
+				if err != nil {
+					errs <- err
+					return
+				}
+				futures = append(futures, f)
+			}
+			for _, f := range futures {
+				if _, err := f.Wait(context.Background()); err != nil {
+					errs <- err
+				}
+			}
+		}(s)
+	}
+	wg.Wait()
+	close(stop)
+	scribblers.Wait()
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	if handled != senders*perSender {
+		t.Fatalf("handled %d messages, want %d", handled, senders*perSender)
+	}
+	if len(corrupt) > 0 {
+		t.Fatalf("%d corrupted payloads, e.g. message %d", len(corrupt), corrupt[0])
+	}
+}
+
+func BenchmarkEncodeMessage(b *testing.B) {
+	msg := newStressMsg(500)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf, err := encodeMessage(json, msg)
+		if err != nil {
+			b.Fatal(err)
+		}
+		releaseBuffer(buf)
+	}
+}
+
+// BenchmarkEncodeMessageUnpooled is the same encoding into a new buffer per message
+func BenchmarkEncodeMessageUnpooled(b *testing.B) {
+	msg := newStressMsg(500)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf := &pooledBuffer{}
+		if err := json(msg, buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package producer
+
+import (
+	j "encoding/json"
+	"io"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+)
+
+// Codec converts values of T to message payloads and back
+type Codec[T any] interface {
+	Encode(v T, wr io.Writer) error
+	Decode(data []byte) (T, error)
+}
+
+// JSONCodec encodes T with encoding/json
+type JSONCodec[T any] struct{}
+
+func (JSONCodec[T]) Encode(v T, wr io.Writer) error {
+	return j.NewEncoder(wr).Encode(v)
+}
+
+func (JSONCodec[T]) Decode(data []byte) (T, error) {
+	var v T
+	err := j.Unmarshal(data, &v)
+	return v, err
+}
+
+// BytesCodec sends payloads as is
+type BytesCodec struct{}
+
+func (BytesCodec) Encode(v []byte, wr io.Writer) error {
+	_, err := wr.Write(v)
+	return err
+}
+
+func (BytesCodec) Decode(data []byte) ([]byte, error) {
+	return data, nil
+}
+
+// StringCodec sends strings as is
+type StringCodec struct{}
+
+func (StringCodec) Encode(v string, wr io.Writer) error {
+	_, err := io.WriteString(wr, v)
+	return err
+}
+
+func (StringCodec) Decode(data []byte) (string, error) {
+	return string(data), nil
+}
+
+// ProtoCodec encodes protobuf messages, New returns an empty message to decode into
+type ProtoCodec[T proto.Message] struct {
+	New func() T
+}
+
+func (ProtoCodec[T]) Encode(v T, wr io.Writer) error {
+	data, err := proto.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = wr.Write(data)
+	return err
+}
+
+func (c ProtoCodec[T]) Decode(data []byte) (T, error) {
+	if c.New == nil {
+		var zero T
+		return zero, errors.New("[kafka] ProtoCodec.New is not set")
+	}
+	v := c.New()
+	return v, proto.Unmarshal(data, v)
+}
+
+// EncoderOf adapts the codec to EncoderFn, see Encoder option
+func EncoderOf[T any](codec Codec[T]) EncoderFn {
+	return func(msg interface{}, wr io.Writer) error {
+		v, ok := msg.(T)
+		if !ok {
+			return errors.Errorf("[kafka] codec expects %T, got %T", v, msg)
+		}
+		return codec.Encode(v, wr)
+	}
+}
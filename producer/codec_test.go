@@ -0,0 +1,90 @@
+package producer
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type order struct {
+	ID    int      `json:"id"`
+	Items []string `json:"items"`
+}
+
+func roundTrip[T any](t *testing.T, codec Codec[T], v T) T {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := codec.Encode(v, &buf); err != nil {
+		t.Fatal(err)
+	}
+	got, err := codec.Decode(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	if want := (order{ID: 7, Items: []string{"a", "b"}}); !reflect.DeepEqual(roundTrip[order](t, JSONCodec[order]{}, want), want) {
+		t.Errorf("JSONCodec changed %+v", want)
+	}
+	if want := []byte{0, 1, 0xff}; !bytes.Equal(roundTrip[[]byte](t, BytesCodec{}, want), want) {
+		t.Errorf("BytesCodec changed %v", want)
+	}
+	if want := "plain text"; roundTrip[string](t, StringCodec{}, want) != want {
+		t.Errorf("StringCodec changed %q", want)
+	}
+
+	codec := ProtoCodec[*wrapperspb.StringValue]{New: func() *wrapperspb.StringValue { return &wrapperspb.StringValue{} }}
+	if want := wrapperspb.String("proto"); !proto.Equal(roundTrip[*wrapperspb.StringValue](t, codec, want), want) {
+		t.Errorf("ProtoCodec changed %v", want)
+	}
+	if _, err := (ProtoCodec[*wrapperspb.StringValue]{}).Decode(nil); err == nil {
+		t.Error("ProtoCodec decodes without New")
+	}
+}
+
+func TestEncoderOfRejectsOtherTypes(t *testing.T) {
+	var buf bytes.Buffer
+	if err := EncoderOf[string](StringCodec{})(42, &buf); err == nil {
+		t.Fatal("an int is encoded by the string codec")
+	}
+}
+
+func TestTypedProducerSendsEncodedValue(t *testing.T) {
+	broker := newMockBroker(t, sarama.NewMockProduceResponse(t).SetVersion(3))
+	defer broker.Close()
+
+	// the value buffer goes back to the pool after the handler
+	values := make(chan []byte, 1)
+	p, err := NewTypedProducer[order]([]string{broker.Addr()}, "events", JSONCodec[order]{},
+		KafkaVersion(sarama.V0_11_0_0),
+		SuccessHandler(func(msg *sarama.ProducerMessage) {
+			value, _ := msg.Value.Encode()
+			values <- append([]byte(nil), value...)
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	want := order{ID: 7, Items: []string{"a"}}
+	if _, err := p.SendSync(ctx, "key", want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := JSONCodec[order]{}.Decode(<-values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("sent %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,72 @@
+package producer
+
+import (
+	"context"
+
+	"github.com/Shopify/sarama"
+)
+
+// Delivery is the broker acknowledgement of a single message
+type Delivery struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+}
+
+// Future is resolved by the message processor once the broker acks the message or the produce fails
+type Future struct {
+	done     chan struct{}
+	delivery Delivery
+	err      error
+}
+
+func newFuture() *Future {
+	return &Future{done: make(chan struct{})}
+}
+
+// Done is closed when the result is available
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait blocks until the result is available or ctx is done, in the latter case the message may still be delivered
+func (f *Future) Wait(ctx context.Context) (Delivery, error) {
+	select {
+	case <-f.done:
+		return f.delivery, f.err
+	case <-ctx.Done():
+		return Delivery{}, ctx.Err()
+	}
+}
+
+func (f *Future) resolve(msg *sarama.ProducerMessage, err error) {
+	f.delivery = Delivery{Topic: msg.Topic, Partition: msg.Partition, Offset: msg.Offset}
+	f.err = err
+	close(f.done)
+}
+
+// metadata travels with sarama.ProducerMessage to the partitioner and back to the message processor
+type metadata struct {
+	// future is set by SendAsync
+	future *Future
+	// value is the message before encoding
+	value interface{}
+	// inFlight is set while the message holds a MaxInFlight slot
+	inFlight bool
+}
+
+func metadataOf(msg *sarama.ProducerMessage) *metadata {
+	if msg == nil {
+		return nil
+	}
+	m, _ := msg.Metadata.(*metadata)
+	return m
+}
+
+// futureOf returns the future attached to the message by SendAsync
+func futureOf(msg *sarama.ProducerMessage) *Future {
+	if m := metadataOf(msg); m != nil {
+		return m.future
+	}
+	return nil
+}
@@ -1,10 +1,14 @@
 package producer
 
-import "io"
+import (
+	"io"
+
+	"github.com/Shopify/sarama"
+)
 
 type EncoderFn func(msg interface{}, wr io.Writer) error
 
-// TODO in case of need of better performance use sync.Pool
+// kafkaByteEncoder is used for keys, values are pooledBuffer
 type kafkaByteEncoder []byte
 
 func (k kafkaByteEncoder) Encode() ([]byte, error) {
@@ -14,7 +18,13 @@ func (k kafkaByteEncoder) Length() int {
 	return len(k)
 }
 
-// TODO zero alloc reset method + take a poiter of the struct
-func (k kafkaByteEncoder) Release() {
-	k = kafkaByteEncoder{}
+// releaseValue returns the value buffer to the pool, the message must not be used by sarama anymore
+func releaseValue(msg *sarama.ProducerMessage) {
+	if msg == nil {
+		return
+	}
+	if buf, ok := msg.Value.(*pooledBuffer); ok {
+		msg.Value = nil
+		releaseBuffer(buf)
+	}
 }
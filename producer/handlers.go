@@ -4,5 +4,10 @@ import (
 	"github.com/Shopify/sarama"
 )
 
+// KafkaErrorHandler and KafkaSuccessHandler get the message before its value buffer is returned to the pool,
+// copy msg.Value if it's needed after the handler returns
 type KafkaErrorHandler func(*sarama.ProducerError)
 type KafkaSuccessHandler func(*sarama.ProducerMessage)
+
+// TopicRouter picks a topic for the message, e.g. by its type or a field
+type TopicRouter func(key string, message interface{}) (string, error)
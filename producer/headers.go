@@ -0,0 +1,8 @@
+package producer
+
+import "github.com/Shopify/sarama"
+
+// Header builds a record header from strings, e.g. content type, schema id, trace context or tenant id
+func Header(key, value string) sarama.RecordHeader {
+	return sarama.RecordHeader{Key: []byte(key), Value: []byte(value)}
+}
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/Shopify/sarama"
+	"kafka/security"
 )
 
 type options struct {
@@ -12,6 +13,12 @@ type options struct {
 	errorHandler   KafkaErrorHandler
 	successHandler KafkaSuccessHandler
 	encoder        EncoderFn
+	tls            *security.TLS
+	sasl           *security.SASL
+	maxInFlight    int
+	router         TopicRouter
+	// connection lists the options changing the shared connection settings, NewFromClient rejects them
+	connection []string
 }
 
 // Option function type
@@ -32,12 +39,14 @@ func Logger(logger Loggerer) Option {
 func Config(config *sarama.Config) Option {
 	return func(conf *options) {
 		conf.config = config
+		conf.connection = append(conf.connection, "Config")
 	}
 }
 
 func KafkaVersion(v sarama.KafkaVersion) Option {
 	return func(conf *options) {
 		conf.config.Version = v
+		conf.connection = append(conf.connection, "KafkaVersion")
 	}
 }
 
@@ -80,8 +89,69 @@ func ProducerRetries(count int) Option {
 	}
 }
 
+// SaramaConfigurator changes the sarama config directly, it's rejected by NewFromClient
 func SaramaConfigurator(f func(*sarama.Config)) Option {
 	return func(conf *options) {
 		f(conf.config)
+		conf.connection = append(conf.connection, "SaramaConfigurator")
+	}
+}
+
+// TLS enables TLS for broker connections, it's rejected by NewFromClient (the client's settings are used)
+func TLS(t security.TLS) Option {
+	return func(conf *options) {
+		conf.tls = &t
+		conf.connection = append(conf.connection, "TLS")
+	}
+}
+
+// SASL enables SASL authentication, it's rejected by NewFromClient (the client's settings are used)
+func SASL(s security.SASL) Option {
+	return func(conf *options) {
+		conf.sasl = &s
+		conf.connection = append(conf.connection, "SASL")
+	}
+}
+
+// MaxInFlight limits messages sent but not acked yet, Send blocks while the limit is reached. 0 means no limit
+func MaxInFlight(n int) Option {
+	return func(conf *options) {
+		conf.maxInFlight = n
+	}
+}
+
+// Router sets a function picking the topic per message, the producer's topic is a fallback when it returns ""
+func Router(r TopicRouter) Option {
+	return func(conf *options) {
+		conf.router = r
+	}
+}
+
+// Partitioner sets the partitioning strategy, e.g. NewMurmur2Partitioner, NewConsistentHashPartitioner,
+// NewStickyPartitioner(n), NewRoundRobinPartitioner or NewFuncPartitioner(fn). Default is sarama's hash partitioner
+func Partitioner(p sarama.PartitionerConstructor) Option {
+	return func(conf *options) {
+		conf.config.Producer.Partitioner = p
+	}
+}
+
+// Idempotent makes the broker deduplicate retried messages, it requires kafka version 0.11+
+// and forces acks from all replicas and a single in-flight request per broker. With NewFromClient
+// the client has to be created with Net.MaxOpenRequests = 1
+func Idempotent() Option {
+	return func(conf *options) {
+		conf.config.Producer.Idempotent = true
+		conf.config.Producer.RequiredAcks = sarama.WaitForAll
+		conf.config.Net.MaxOpenRequests = 1
+		if conf.config.Producer.Retry.Max < 1 {
+			conf.config.Producer.Retry.Max = 1
+		}
+	}
+}
+
+// TransactionTimeout is the time a transaction may stay open before the broker aborts it (default 1 min)
+func TransactionTimeout(timeout time.Duration) Option {
+	return func(conf *options) {
+		conf.config.Producer.Transaction.Timeout = timeout
 	}
 }
@@ -0,0 +1,194 @@
+package producer
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math/rand"
+
+	"github.com/Shopify/sarama"
+	"github.com/pkg/errors"
+)
+
+// PartitionFn picks a partition for the message, key is nil for messages sent without a key
+type PartitionFn func(key []byte, message interface{}, numPartitions int32) (int32, error)
+
+// NewMurmur2Partitioner hashes keys the way the Java client does, so both place a key on the same partition.
+// Messages without a key are spread round robin
+func NewMurmur2Partitioner(topic string) sarama.Partitioner {
+	return &keyPartitioner{
+		hash:   murmur2Partition,
+		nilKey: sarama.NewRoundRobinPartitioner(topic),
+	}
+}
+
+// NewConsistentHashPartitioner uses jump consistent hash, when partitions are added only ~1/n of the keys move.
+// Messages without a key are spread round robin
+func NewConsistentHashPartitioner(topic string) sarama.Partitioner {
+	return &keyPartitioner{
+		hash:   jumpPartition,
+		nilKey: sarama.NewRoundRobinPartitioner(topic),
+	}
+}
+
+// NewStickyPartitioner sends messages without a key to one partition until batchSize of them are sent,
+// then switches to another one, so batches fill up faster. Keys are hashed with murmur2
+func NewStickyPartitioner(batchSize int) sarama.PartitionerConstructor {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	return func(topic string) sarama.Partitioner {
+		return &keyPartitioner{
+			hash:   murmur2Partition,
+			nilKey: &stickyPartitioner{batchSize: batchSize, partition: -1},
+		}
+	}
+}
+
+// NewRoundRobinPartitioner walks through the partitions one at a time, keys are ignored
+func NewRoundRobinPartitioner(topic string) sarama.Partitioner {
+	return sarama.NewRoundRobinPartitioner(topic)
+}
+
+// NewFuncPartitioner calls fn with the message as it was passed to Send
+func NewFuncPartitioner(fn PartitionFn) sarama.PartitionerConstructor {
+	return func(topic string) sarama.Partitioner {
+		return &funcPartitioner{fn: fn}
+	}
+}
+
+// keyPartitioner hashes keys and delegates messages without a key
+type keyPartitioner struct {
+	hash   func(key []byte, numPartitions int32) int32
+	nilKey sarama.Partitioner
+}
+
+func (p *keyPartitioner) Partition(msg *sarama.ProducerMessage, numPartitions int32) (int32, error) {
+	if msg.Key == nil {
+		return p.nilKey.Partition(msg, numPartitions)
+	}
+	key, err := msg.Key.Encode()
+	if err != nil {
+		return -1, err
+	}
+	return p.hash(key, numPartitions), nil
+}
+
+func (p *keyPartitioner) RequiresConsistency() bool {
+	return true
+}
+
+func (p *keyPartitioner) MessageRequiresConsistency(msg *sarama.ProducerMessage) bool {
+	return msg.Key != nil
+}
+
+type stickyPartitioner struct {
+	batchSize int
+	partition int32
+	sent      int
+}
+
+func (p *stickyPartitioner) Partition(_ *sarama.ProducerMessage, numPartitions int32) (int32, error) {
+	if p.partition < 0 || p.partition >= numPartitions || p.sent >= p.batchSize {
+		next := rand.Int31n(numPartitions)
+		if next == p.partition && numPartitions > 1 {
+			next = (next + 1) % numPartitions
+		}
+		p.partition, p.sent = next, 0
+	}
+	p.sent++
+	return p.partition, nil
+}
+
+func (p *stickyPartitioner) RequiresConsistency() bool {
+	return false
+}
+
+type funcPartitioner struct {
+	fn PartitionFn
+}
+
+func (p *funcPartitioner) Partition(msg *sarama.ProducerMessage, numPartitions int32) (int32, error) {
+	var key []byte
+	if msg.Key != nil {
+		k, err := msg.Key.Encode()
+		if err != nil {
+			return -1, err
+		}
+		key = k
+	}
+
+	var value interface{}
+	if m := metadataOf(msg); m != nil {
+		value = m.value
+	}
+
+	partition, err := p.fn(key, value, numPartitions)
+	if err != nil {
+		return -1, err
+	}
+	if partition < 0 || partition >= numPartitions {
+		return -1, errors.Errorf("[kafka] partition %d is out of range [0, %d)", partition, numPartitions)
+	}
+	return partition, nil
+}
+
+func (p *funcPartitioner) RequiresConsistency() bool {
+	return true
+}
+
+func murmur2Partition(key []byte, numPartitions int32) int32 {
+	return int32(murmur2(key)&0x7fffffff) % numPartitions
+}
+
+// murmur2 is a port of org.apache.kafka.common.utils.Utils.murmur2
+func murmur2(data []byte) uint32 {
+	const (
+		seed uint32 = 0x9747b28c
+		m    uint32 = 0x5bd1e995
+		r           = 24
+	)
+	length := len(data)
+	h := seed ^ uint32(length)
+
+	for i := 0; i+4 <= length; i += 4 {
+		k := binary.LittleEndian.Uint32(data[i:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+
+	tail := length &^ 3
+	switch length % 4 {
+	case 3:
+		h ^= uint32(data[tail+2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(data[tail+1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(data[tail])
+		h *= m
+	}
+
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return h
+}
+
+// jumpPartition is "A Fast, Minimal Memory, Consistent Hash Algorithm" by Lamping and Veach
+func jumpPartition(key []byte, numPartitions int32) int32 {
+	hasher := fnv.New64a()
+	_, _ = hasher.Write(key)
+	k := hasher.Sum64()
+
+	var b, j int64 = -1, 0
+	for j < int64(numPartitions) {
+		b = j
+		k = k*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((k>>33)+1)))
+	}
+	return int32(b)
+}
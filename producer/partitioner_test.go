@@ -0,0 +1,27 @@
+package producer
+
+import "testing"
+
+// TestMurmur2 uses the values of Kafka's org.apache.kafka.common.utils.UtilsTest, so keys land on the partitions
+// the Java client picks
+func TestMurmur2(t *testing.T) {
+	for key, want := range map[string]int32{
+		"21":                         -973932308,
+		"foobar":                     -790332482,
+		"a-little-bit-long-string":   -985981536,
+		"a-little-bit-longer-string": -1486304829,
+		"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8": -58897971,
+		"abc": 479470107,
+	} {
+		if got := int32(murmur2([]byte(key))); got != want {
+			t.Errorf("murmur2(%q) = %d, want %d", key, got, want)
+		}
+	}
+}
+
+func TestMurmur2Partition(t *testing.T) {
+	// toPositive(-790332482) % 10
+	if got := murmur2Partition([]byte("foobar"), 10); got != 1357151166%10 {
+		t.Fatalf("foobar went to partition %d, want %d", got, 1357151166%10)
+	}
+}
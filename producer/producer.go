@@ -1,13 +1,17 @@
 package producer
 
 import (
+	"context"
 	j "encoding/json"
 	"io"
 	"os"
+	"strings"
+	"sync"
 
 	"github.com/Shopify/sarama"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
+	"kafka/security"
 )
 
 // json encoder implementation
@@ -21,46 +25,121 @@ type KafkaProducer struct {
 	config         *sarama.Config
 	producer       sarama.AsyncProducer
 	topic          string
+	router         TopicRouter
 	encoder        EncoderFn
 	errorHandler   KafkaErrorHandler
 	successHandler KafkaSuccessHandler
+
+	// inFlight bounds messages waiting for the broker ack, nil means unbounded
+	inFlight chan struct{}
+
+	processorDone chan struct{}
+	closing       chan struct{}
+	closeOnce     sync.Once
+	// mu guards Input() against AsyncClose, senders hold it for reading
+	mu     sync.RWMutex
+	closed bool
+	// closeErrs are the errors of messages flushed by Close, returned by it like sarama's Close
+	closeErrs sarama.ProducerErrors
 }
 
+var ErrProducerClosed = errors.New("[kafka] producer is closed")
+
 func NewKafkaProducer(brokerList []string, topic string, opts ...Option) (*KafkaProducer, error) {
-	l := zerolog.New(os.Stdout)
-	conf := &options{config: sarama.NewConfig(), logger: &l, encoder: json}
-	for _, opt := range opts {
-		opt(conf)
+	conf := newOptions(sarama.NewConfig(), opts...)
+	if err := security.Apply(conf.config, conf.tls, conf.sasl); err != nil {
+		return nil, err
 	}
 
 	producer, err := newAsyncProducer(brokerList, conf.config)
 	if err != nil {
 		return nil, err
 	}
+	return newKafkaProducer(producer, topic, conf), nil
+}
+
+// NewFromClient creates a producer on top of an existing client, so version, client ID, TLS and SASL
+// settings and the connection pool are shared with it. Options changing the connection (Config, KafkaVersion,
+// SaramaConfigurator, TLS, SASL) are rejected, the producer settings apply to this producer only.
+// Close doesn't close the client, it has to be closed after the producer
+func NewFromClient(client sarama.Client, topic string, opts ...Option) (*KafkaProducer, error) {
+	if client == nil {
+		return nil, errors.New("[kafka] client is not set")
+	}
+	shared := client.Config()
+	// options are applied to a copy, so the connection settings of the running client never change
+	copied := *shared
+	conf := newOptions(&copied, opts...)
+	if len(conf.connection) > 0 {
+		return nil, errors.Errorf("[kafka] %s can't be used with a shared client", strings.Join(conf.connection, ", "))
+	}
+	if copied.Net.MaxOpenRequests != shared.Net.MaxOpenRequests {
+		return nil, errors.Errorf("[kafka] Idempotent requires a client with Net.MaxOpenRequests = 1, got %d",
+			shared.Net.MaxOpenRequests)
+	}
+	if err := copied.Validate(); err != nil {
+		return nil, errors.Wrap(err, "[kafka] invalid producer config")
+	}
+
+	producer, err := sarama.NewAsyncProducerFromClient(&configuredClient{Client: client, config: &copied})
+	if err != nil {
+		return nil, errors.Wrap(err, "[kafka] failed to start async producer")
+	}
+	return newKafkaProducer(producer, topic, conf), nil
+}
 
+// configuredClient gives sarama the producer's own copy of the config, the shared one is never changed
+type configuredClient struct {
+	sarama.Client
+	config *sarama.Config
+}
+
+func (c *configuredClient) Config() *sarama.Config {
+	return c.config
+}
+
+func newOptions(config *sarama.Config, opts ...Option) *options {
+	l := zerolog.New(os.Stdout)
+	conf := &options{config: config, logger: &l, encoder: json}
+	for _, opt := range opts {
+		opt(conf)
+	}
+	// results are always read by the message processor, SendSync and SendAsync rely on them
+	conf.config.Producer.Return.Successes = true
+	conf.config.Producer.Return.Errors = true
+	return conf
+}
+
+func newKafkaProducer(producer sarama.AsyncProducer, topic string, conf *options) *KafkaProducer {
 	stream := &KafkaProducer{
 		logger:         conf.logger,
 		config:         conf.config,
 		producer:       producer,
 		topic:          topic,
+		router:         conf.router,
 		encoder:        conf.encoder,
 		errorHandler:   conf.errorHandler,
 		successHandler: conf.successHandler,
+		processorDone:  make(chan struct{}),
+		closing:        make(chan struct{}),
 	}
-
-	if conf.config.Producer.Return.Errors || conf.config.Producer.Return.Successes {
-		if stream.errorHandler != nil || stream.successHandler != nil {
-			go stream.runMsgProcessor()
-		}
+	if conf.maxInFlight > 0 {
+		stream.inFlight = make(chan struct{}, conf.maxInFlight)
 	}
-	return stream, nil
+
+	go stream.runMsgProcessor()
+	return stream
 }
 
+// runMsgProcessor reads results until the producer is closed, resolves the futures of SendAsync
+// and passes every result to the handlers
 func (s *KafkaProducer) runMsgProcessor() {
+	defer close(s.processorDone)
+
 	successHandler := s.successHandler
 	if successHandler == nil {
 		successHandler = func(msg *sarama.ProducerMessage) {
-			s.logger.Info().Msgf("[kafka] %s [%s] success partition=%d offset=%d\n",
+			s.logger.Debug().Msgf("[kafka] %s [%s] success partition=%d offset=%d\n",
 				msg.Timestamp, msg.Topic, msg.Partition, msg.Offset)
 		}
 	}
@@ -72,22 +151,36 @@ func (s *KafkaProducer) runMsgProcessor() {
 		}
 	}
 
-loop:
-	for {
+	errorsCh, successesCh := s.producer.Errors(), s.producer.Successes()
+	for errorsCh != nil || successesCh != nil {
 		select {
-		case errMsg, ok := <-s.producer.Errors():
+		case errMsg, ok := <-errorsCh:
 			if !ok {
-				break loop
+				errorsCh = nil
+				continue
+			}
+			s.releaseInFlight(errMsg.Msg)
+			select {
+			case <-s.closing:
+				s.closeErrs = append(s.closeErrs, errMsg)
+			default:
+			}
+			if f := futureOf(errMsg.Msg); f != nil {
+				f.resolve(errMsg.Msg, errMsg.Err)
 			}
 			errorHandler(errMsg)
-		case msg, ok := <-s.producer.Successes():
+			releaseValue(errMsg.Msg)
+		case msg, ok := <-successesCh:
 			if !ok {
-				break loop
+				successesCh = nil
+				continue
 			}
-			successHandler(msg)
-			if msg.Value != nil {
-				msg.Value.(kafkaByteEncoder).Release()
+			s.releaseInFlight(msg)
+			if f := futureOf(msg); f != nil {
+				f.resolve(msg, nil)
 			}
+			successHandler(msg)
+			releaseValue(msg)
 		}
 	}
 }
@@ -104,37 +197,190 @@ func newAsyncProducer(brokers []string, conf *sarama.Config) (sarama.AsyncProduc
 	return producer, nil
 }
 
-// Key is used for sending a message to particular partirion if that's required, if it's not set Round Robin will be
-// implemented while message distribution
-func (s *KafkaProducer) Send(key string, message interface{}) error {
-	data, err := s.encodeMessage(message)
+// Key is used for sending a message to particular partirion if that's required, if it's empty the message is sent
+// without a key and the partitioner spreads it (see Partitioner option)
+// Send blocks while the in-flight limit is reached, it returns ctx error if ctx is done first
+// and ErrProducerClosed after Close. Headers require kafka version 0.11+
+func (s *KafkaProducer) Send(ctx context.Context, key string, message interface{}, headers ...sarama.RecordHeader) error {
+	topic, err := s.route(key, message)
 	if err != nil {
-		return errors.Wrap(err, "[kafka] can't encode message")
+		return err
 	}
+	return s.sendTo(ctx, s.encoder, topic, key, message, headers)
+}
+
+// SendTo is Send to the given topic, the router and the producer's topic are bypassed
+func (s *KafkaProducer) SendTo(ctx context.Context, topic, key string, message interface{}, headers ...sarama.RecordHeader) error {
+	return s.sendTo(ctx, s.encoder, topic, key, message, headers)
+}
 
-	s.producer.Input() <- &sarama.ProducerMessage{
-		Topic: s.topic,
-		Key:   kafkaByteEncoder(key),
-		Value: kafkaByteEncoder(data),
+func (s *KafkaProducer) sendTo(ctx context.Context, enc EncoderFn, topic, key string, message interface{}, headers []sarama.RecordHeader) error {
+	msg, err := s.buildMessage(enc, topic, key, message, headers)
+	if err != nil {
+		return err
 	}
-	return nil
+	return s.enqueue(ctx, msg)
+}
+
+// SendAsync enqueues the message and returns a future resolved with its partition/offset or the produce error
+func (s *KafkaProducer) SendAsync(ctx context.Context, key string, message interface{}, headers ...sarama.RecordHeader) (*Future, error) {
+	return s.sendAsync(ctx, s.encoder, key, message, headers)
+}
+
+func (s *KafkaProducer) sendAsync(ctx context.Context, enc EncoderFn, key string, message interface{}, headers []sarama.RecordHeader) (*Future, error) {
+	topic, err := s.route(key, message)
+	if err != nil {
+		return nil, err
+	}
+	return s.sendAsyncTo(ctx, enc, topic, key, message, headers)
+}
+
+func (s *KafkaProducer) sendAsyncTo(ctx context.Context, enc EncoderFn, topic, key string, message interface{}, headers []sarama.RecordHeader) (*Future, error) {
+	msg, err := s.buildMessage(enc, topic, key, message, headers)
+	if err != nil {
+		return nil, err
+	}
+	f := newFuture()
+	metadataOf(msg).future = f
+
+	if err := s.enqueue(ctx, msg); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// SendSync blocks until the broker acks the message
+func (s *KafkaProducer) SendSync(ctx context.Context, key string, message interface{}, headers ...sarama.RecordHeader) (Delivery, error) {
+	f, err := s.SendAsync(ctx, key, message, headers...)
+	if err != nil {
+		return Delivery{}, err
+	}
+	return f.Wait(ctx)
+}
+
+// SendSyncTo is SendSync to the given topic, the router and the producer's topic are bypassed
+func (s *KafkaProducer) SendSyncTo(ctx context.Context, topic, key string, message interface{}, headers ...sarama.RecordHeader) (Delivery, error) {
+	f, err := s.sendAsyncTo(ctx, s.encoder, topic, key, message, headers)
+	if err != nil {
+		return Delivery{}, err
+	}
+	return f.Wait(ctx)
 }
 
-func (s *KafkaProducer) encodeMessage(msg interface{}) ([]byte, error) {
+// enqueue passes the message to sarama, the value buffer is released if it fails
+func (s *KafkaProducer) enqueue(ctx context.Context, msg *sarama.ProducerMessage) (err error) {
+	defer func() {
+		if err != nil {
+			releaseValue(msg)
+		}
+	}()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return ErrProducerClosed
+	}
+
+	if s.inFlight != nil {
+		select {
+		case s.inFlight <- struct{}{}:
+			metadataOf(msg).inFlight = true
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.closing:
+			return ErrProducerClosed
+		}
+	}
+
+	select {
+	case s.producer.Input() <- msg:
+		return nil
+	case <-ctx.Done():
+		s.releaseInFlight(msg)
+		return ctx.Err()
+	case <-s.closing:
+		s.releaseInFlight(msg)
+		return ErrProducerClosed
+	}
+}
+
+// releaseInFlight frees the slot of the message, messages written to Producer().Input() directly don't take one
+func (s *KafkaProducer) releaseInFlight(msg *sarama.ProducerMessage) {
+	m := metadataOf(msg)
+	if m == nil || !m.inFlight {
+		return
+	}
+	m.inFlight = false
+	<-s.inFlight
+}
+
+// route picks the message topic, the producer's topic is used if there is no router or it returns ""
+func (s *KafkaProducer) route(key string, message interface{}) (string, error) {
+	if s.router != nil {
+		topic, err := s.router(key, message)
+		if err != nil {
+			return "", errors.Wrap(err, "[kafka] can't route message")
+		}
+		if topic != "" {
+			return topic, nil
+		}
+	}
+	return s.topic, nil
+}
+
+func (s *KafkaProducer) buildMessage(enc EncoderFn, topic, key string, message interface{}, headers []sarama.RecordHeader) (*sarama.ProducerMessage, error) {
+	if topic == "" {
+		return nil, errors.New("[kafka] topic is not set")
+	}
+
+	buf, err := encodeMessage(enc, message)
+	if err != nil {
+		return nil, errors.Wrap(err, "[kafka] can't encode message")
+	}
+
+	msg := &sarama.ProducerMessage{
+		Topic:    topic,
+		Value:    buf,
+		Headers:  headers,
+		Metadata: &metadata{value: message},
+	}
+	// nil key lets the partitioner spread the message instead of hashing "" to a single partition
+	if key != "" {
+		msg.Key = kafkaByteEncoder(key)
+	}
+	return msg, nil
+}
+
+// encodeMessage returns a pooled buffer owned by the caller, it's released by the message processor
+// once the message result is handled, or by enqueue if the message doesn't get to the producer
+func encodeMessage(enc EncoderFn, msg interface{}) (*pooledBuffer, error) {
 	buf := acquireBuffer()
-	if err := s.encoder(msg, buf); err != nil {
+	if err := enc(msg, buf); err != nil {
 		releaseBuffer(buf)
 		return nil, err
 	}
-	result := buf.Bytes()
-	releaseBuffer(buf)
-	return result, nil
+	return buf, nil
 }
 
+// Close flushes buffered messages and waits until their results are handled, it's safe to call it more than once.
+// Messages failed during the flush are returned as sarama.ProducerErrors
 func (s *KafkaProducer) Close() error {
-	return s.producer.Close()
+	s.closeOnce.Do(func() {
+		// unblock waiting senders first, then wait for the ones writing to Input()
+		close(s.closing)
+		s.mu.Lock()
+		s.closed = true
+		s.producer.AsyncClose()
+		s.mu.Unlock()
+	})
+	<-s.processorDone
+	if len(s.closeErrs) > 0 {
+		return s.closeErrs
+	}
+	return nil
 }
 
+// Producer exposes the sarama producer, messages written to its Input bypass MaxInFlight and the futures
 func (s *KafkaProducer) Producer() sarama.AsyncProducer {
 	return s.producer
 }
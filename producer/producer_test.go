@@ -0,0 +1,144 @@
+package producer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+func newMockBroker(t *testing.T, produce sarama.MockResponse) *sarama.MockBroker {
+	broker := sarama.NewMockBroker(t, 1)
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("events", 0, broker.BrokerID()),
+		"ProduceRequest": produce,
+	})
+	return broker
+}
+
+func TestDirectInputDoesntBlockInFlight(t *testing.T) {
+	broker := newMockBroker(t, sarama.NewMockProduceResponse(t).SetVersion(3))
+	defer broker.Close()
+
+	p, err := NewKafkaProducer([]string{broker.Addr()}, "events", KafkaVersion(sarama.V0_11_0_0), MaxInFlight(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	// results of messages without a slot must not wait for one
+	for i := 0; i < 3; i++ {
+		p.Producer().Input() <- &sarama.ProducerMessage{Topic: "events", Value: sarama.StringEncoder("direct")}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for i := 0; i < 3; i++ {
+		if _, err := p.SendSync(ctx, "key", "value"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCloseReturnsFlushErrors(t *testing.T) {
+	broker := newMockBroker(t, sarama.NewMockProduceResponse(t).SetVersion(3).
+		SetError("events", 0, sarama.ErrMessageSizeTooLarge))
+	defer broker.Close()
+
+	// the message is still buffered when Close starts, it fails once the flush timer fires
+	p, err := NewKafkaProducer([]string{broker.Addr()}, "events", KafkaVersion(sarama.V0_11_0_0),
+		FlushFrequency(200*time.Millisecond), FlushMessages(100), ProducerRetries(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Send(context.Background(), "key", "value"); err != nil {
+		t.Fatal(err)
+	}
+
+	err = p.Close()
+	var errs sarama.ProducerErrors
+	if !errors.As(err, &errs) || len(errs) != 1 || !errors.Is(errs[0].Err, sarama.ErrMessageSizeTooLarge) {
+		t.Fatalf("got %v, want the flush error", err)
+	}
+	if err := p.Close(); err == nil {
+		t.Fatal("second Close lost the error")
+	}
+}
+
+func TestNewFromClientKeepsSharedConfig(t *testing.T) {
+	broker := newMockBroker(t, sarama.NewMockProduceResponse(t).SetVersion(3))
+	defer broker.Close()
+
+	cfg := sarama.NewConfig()
+	cfg.Version = sarama.V0_11_0_0
+	client, err := sarama.NewClient([]string{broker.Addr()}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	gzip, err := NewFromClient(client, "events", Compression(sarama.CompressionGZIP, sarama.CompressionLevelDefault), ProducerRetries(9))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gzip.Close()
+	plain, err := NewFromClient(client, "events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plain.Close()
+
+	if got := client.Config().Producer; got.Compression != sarama.CompressionNone || got.Retry.Max == 9 {
+		t.Fatalf("shared config changed: compression=%v retries=%d", got.Compression, got.Retry.Max)
+	}
+	if got := gzip.config.Producer; got.Compression != sarama.CompressionGZIP || got.Retry.Max != 9 {
+		t.Fatalf("producer config: compression=%v retries=%d", got.Compression, got.Retry.Max)
+	}
+	if got := plain.config.Producer.Compression; got != sarama.CompressionNone {
+		t.Fatalf("second producer got compression %v", got)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, p := range []*KafkaProducer{gzip, plain} {
+		if _, err := p.SendSync(ctx, "key", "value"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// inputProducer buffers the input, nothing is acked
+type inputProducer struct {
+	sarama.AsyncProducer
+	input chan *sarama.ProducerMessage
+}
+
+func (p *inputProducer) Input() chan<- *sarama.ProducerMessage { return p.input }
+
+func TestDirectInputResultKeepsSlot(t *testing.T) {
+	p := &KafkaProducer{
+		producer: &inputProducer{input: make(chan *sarama.ProducerMessage, 3)},
+		inFlight: make(chan struct{}, 1),
+	}
+	sent := &sarama.ProducerMessage{Topic: "events", Metadata: &metadata{}}
+	if err := p.enqueue(context.Background(), sent); err != nil {
+		t.Fatal(err)
+	}
+
+	// the result of a direct Input() message doesn't free the slot of the sent one
+	p.releaseInFlight(&sarama.ProducerMessage{Topic: "events"})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.enqueue(ctx, &sarama.ProducerMessage{Topic: "events", Metadata: &metadata{}}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want the limit to be kept", err)
+	}
+
+	p.releaseInFlight(sent)
+	p.releaseInFlight(sent)
+	if err := p.enqueue(context.Background(), &sarama.ProducerMessage{Topic: "events", Metadata: &metadata{}}); err != nil {
+		t.Fatal(err)
+	}
+}
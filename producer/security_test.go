@@ -0,0 +1,47 @@
+package producer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"kafka/security"
+	"kafka/security/securitytest"
+)
+
+func TestTLS(t *testing.T) {
+	files := securitytest.NewFiles(t)
+	broker := sarama.NewMockBrokerListener(t, 1, securitytest.Listener(t, files))
+	defer broker.Close()
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("events", 0, broker.BrokerID()),
+		"ProduceRequest": sarama.NewMockProduceResponse(t).SetVersion(3),
+	})
+
+	p, err := NewKafkaProducer([]string{broker.Addr()}, "events",
+		KafkaVersion(sarama.V0_11_0_0),
+		TLS(security.TLS{CAFile: files.CA, CertFile: files.ClientCert, KeyFile: files.ClientKey}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	if !p.config.Net.TLS.Enable || p.config.Net.TLS.Config == nil {
+		t.Fatal("TLS is not enabled on the producer")
+	}
+	if _, err := p.SendSync(context.Background(), "key", "value"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTLSInvalid(t *testing.T) {
+	if _, err := NewKafkaProducer([]string{"127.0.0.1:1"}, "events", TLS(security.TLS{CAFile: "missing.pem"})); err == nil {
+		t.Fatal("no error for a missing CA file")
+	}
+	if _, err := NewKafkaProducer([]string{"127.0.0.1:1"}, "events", SASL(security.SASL{Mechanism: "GSSAPI", User: "user"})); err == nil {
+		t.Fatal("no error for an unsupported SASL mechanism")
+	}
+}
@@ -0,0 +1,64 @@
+package producer
+
+import (
+	"github.com/Shopify/sarama"
+	"github.com/pkg/errors"
+)
+
+// TransactionalProducer writes messages to several topics and commits consumed offsets atomically.
+// Usage:
+//  1. BeginTxn()
+//  2. Send/SendTo ... and SendOffsetsToTxn or SendMessageToTxn for consumed messages
+//  3. Commit(), or Abort() if anything failed (Commit returns the errors of the messages sent in the transaction)
+type TransactionalProducer struct {
+	*KafkaProducer
+}
+
+// NewTransactionalProducer creates an idempotent producer with the transactional ID, the ID has to be stable
+// across restarts of the same instance so the broker fences its zombies
+func NewTransactionalProducer(brokerList []string, topic, transactionalID string, opts ...Option) (*TransactionalProducer, error) {
+	if transactionalID == "" {
+		return nil, errors.New("[kafka] transactional ID is not set")
+	}
+
+	opts = append(opts, Idempotent(), func(conf *options) {
+		conf.config.Producer.Transaction.ID = transactionalID
+		// transactions need at least 0.11, keep the user's version if it's newer
+		if !conf.config.Version.IsAtLeast(sarama.V0_11_0_0) {
+			conf.config.Version = sarama.V0_11_0_0
+		}
+	})
+
+	p, err := NewKafkaProducer(brokerList, topic, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &TransactionalProducer{KafkaProducer: p}, nil
+}
+
+func (t *TransactionalProducer) BeginTxn() error {
+	return errors.Wrap(t.producer.BeginTxn(), "[kafka] can't begin transaction")
+}
+
+// SendOffsetsToTxn commits consumer group offsets as a part of the transaction
+func (t *TransactionalProducer) SendOffsetsToTxn(offsets map[string][]*sarama.PartitionOffsetMetadata, groupID string) error {
+	return errors.Wrap(t.producer.AddOffsetsToTxn(offsets, groupID), "[kafka] can't add offsets to transaction")
+}
+
+// SendMessageToTxn commits the offset of a consumed message as a part of the transaction
+func (t *TransactionalProducer) SendMessageToTxn(msg *sarama.ConsumerMessage, groupID string) error {
+	return errors.Wrap(t.producer.AddMessageToTxn(msg, groupID, nil), "[kafka] can't add message to transaction")
+}
+
+// Commit flushes the messages of the transaction and commits it
+func (t *TransactionalProducer) Commit() error {
+	return errors.Wrap(t.producer.CommitTxn(), "[kafka] can't commit transaction")
+}
+
+func (t *TransactionalProducer) Abort() error {
+	return errors.Wrap(t.producer.AbortTxn(), "[kafka] can't abort transaction")
+}
+
+func (t *TransactionalProducer) TxnStatus() sarama.ProducerTxnStatusFlag {
+	return t.producer.TxnStatus()
+}
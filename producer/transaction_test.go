@@ -0,0 +1,123 @@
+package producer
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// newTxnBroker is the coordinator of the transactional ID and the leader of events, sarama has no mock
+// responses for the transaction requests
+func newTxnBroker(t *testing.T, transactionalID string) *sarama.MockBroker {
+	broker := sarama.NewMockBroker(t, 1)
+	t.Cleanup(broker.Close)
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("events", 0, broker.BrokerID()),
+		"FindCoordinatorRequest": sarama.NewMockFindCoordinatorResponse(t).
+			SetCoordinator(sarama.CoordinatorTransaction, transactionalID, broker),
+		"InitProducerIDRequest": sarama.NewMockWrapper(&sarama.InitProducerIDResponse{ProducerID: 1}),
+		"AddPartitionsToTxnRequest": sarama.NewMockWrapper(&sarama.AddPartitionsToTxnResponse{
+			Errors: map[string][]*sarama.PartitionError{"events": {{Partition: 0}}},
+		}),
+		"ProduceRequest": sarama.NewMockProduceResponse(t).SetVersion(3),
+		"EndTxnRequest":  sarama.NewMockWrapper(&sarama.EndTxnResponse{}),
+	})
+	return broker
+}
+
+// endTxnResults are the results of the EndTxn requests the broker got, true is a commit
+func endTxnResults(broker *sarama.MockBroker) []bool {
+	var results []bool
+	for _, rr := range broker.History() {
+		if req, ok := rr.Request.(*sarama.EndTxnRequest); ok {
+			results = append(results, req.TransactionResult)
+		}
+	}
+	return results
+}
+
+func TestTransactionalProducer(t *testing.T) {
+	for _, commit := range []bool{true, false} {
+		broker := newTxnBroker(t, "billing-1")
+		p, err := NewTransactionalProducer([]string{broker.Addr()}, "events", "billing-1", KafkaVersion(sarama.V0_11_0_0))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := p.BeginTxn(); err != nil {
+			t.Fatal(err)
+		}
+		if p.TxnStatus()&sarama.ProducerTxnFlagInTransaction == 0 {
+			t.Fatalf("status %v after BeginTxn", p.TxnStatus())
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if _, err := p.SendSync(ctx, "key", "value"); err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+
+		end := p.Commit
+		if !commit {
+			end = p.Abort
+		}
+		if err := end(); err != nil {
+			t.Fatal(err)
+		}
+		if p.TxnStatus()&sarama.ProducerTxnFlagReady == 0 {
+			t.Fatalf("status %v after the transaction", p.TxnStatus())
+		}
+		if got := endTxnResults(broker); len(got) != 1 || got[0] != commit {
+			t.Fatalf("ended with %v, want commit=%v", got, commit)
+		}
+		if err := p.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTransactionalProducerOptions(t *testing.T) {
+	if _, err := NewTransactionalProducer([]string{"localhost:9092"}, "events", ""); err == nil {
+		t.Fatal("an empty transactional ID is accepted")
+	}
+
+	// an older version is raised to 0.11
+	broker := newTxnBroker(t, "billing-1")
+	p, err := NewTransactionalProducer([]string{broker.Addr()}, "events", "billing-1",
+		KafkaVersion(sarama.V0_10_2_0), ProducerRetries(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	conf := p.config
+	if !conf.Version.IsAtLeast(sarama.V0_11_0_0) || conf.Producer.Transaction.ID != "billing-1" {
+		t.Fatalf("version %v, transactional ID %q", conf.Version, conf.Producer.Transaction.ID)
+	}
+	if !conf.Producer.Idempotent || conf.Producer.RequiredAcks != sarama.WaitForAll ||
+		conf.Net.MaxOpenRequests != 1 || conf.Producer.Retry.Max != 1 {
+		t.Fatalf("not idempotent: %+v", conf.Producer)
+	}
+}
+
+func TestIdempotent(t *testing.T) {
+	if _, err := NewKafkaProducer([]string{"localhost:9092"}, "events", Idempotent(), KafkaVersion(sarama.V0_10_2_0)); err == nil {
+		t.Fatal("an idempotent producer is accepted below 0.11")
+	}
+
+	broker := newMockBroker(t, sarama.NewMockProduceResponse(t).SetVersion(3))
+	defer broker.Close()
+	cfg := sarama.NewConfig()
+	cfg.Version = sarama.V0_11_0_0
+	client, err := sarama.NewClient([]string{broker.Addr()}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if _, err := NewFromClient(client, "events", Idempotent()); err == nil || !strings.Contains(err.Error(), "MaxOpenRequests") {
+		t.Fatalf("got %v, want the client to be rejected", err)
+	}
+}
@@ -0,0 +1,77 @@
+package producer
+
+import (
+	"context"
+
+	"github.com/Shopify/sarama"
+)
+
+// TypedProducer sends values of T encoded by the codec, so type mistakes are caught by the compiler.
+// It shares the buffer pool, router, partitioner and delivery handling of the wrapped KafkaProducer
+type TypedProducer[T any] struct {
+	producer *KafkaProducer
+	encoder  EncoderFn
+}
+
+// NewTyped wraps the producer, the producer's Encoder is not used by the typed producer
+func NewTyped[T any](p *KafkaProducer, codec Codec[T]) *TypedProducer[T] {
+	return &TypedProducer[T]{
+		producer: p,
+		encoder:  EncoderOf(codec),
+	}
+}
+
+// NewTypedProducer creates a KafkaProducer for the typed producer, see NewKafkaProducer
+func NewTypedProducer[T any](brokerList []string, topic string, codec Codec[T], opts ...Option) (*TypedProducer[T], error) {
+	p, err := NewKafkaProducer(brokerList, topic, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return NewTyped(p, codec), nil
+}
+
+// Send see KafkaProducer.Send
+func (t *TypedProducer[T]) Send(ctx context.Context, key string, v T, headers ...sarama.RecordHeader) error {
+	topic, err := t.producer.route(key, v)
+	if err != nil {
+		return err
+	}
+	return t.producer.sendTo(ctx, t.encoder, topic, key, v, headers)
+}
+
+// SendTo see KafkaProducer.SendTo
+func (t *TypedProducer[T]) SendTo(ctx context.Context, topic, key string, v T, headers ...sarama.RecordHeader) error {
+	return t.producer.sendTo(ctx, t.encoder, topic, key, v, headers)
+}
+
+// SendAsync see KafkaProducer.SendAsync
+func (t *TypedProducer[T]) SendAsync(ctx context.Context, key string, v T, headers ...sarama.RecordHeader) (*Future, error) {
+	return t.producer.sendAsync(ctx, t.encoder, key, v, headers)
+}
+
+// SendSync see KafkaProducer.SendSync
+func (t *TypedProducer[T]) SendSync(ctx context.Context, key string, v T, headers ...sarama.RecordHeader) (Delivery, error) {
+	f, err := t.SendAsync(ctx, key, v, headers...)
+	if err != nil {
+		return Delivery{}, err
+	}
+	return f.Wait(ctx)
+}
+
+// SendSyncTo see KafkaProducer.SendSyncTo
+func (t *TypedProducer[T]) SendSyncTo(ctx context.Context, topic, key string, v T, headers ...sarama.RecordHeader) (Delivery, error) {
+	f, err := t.producer.sendAsyncTo(ctx, t.encoder, topic, key, v, headers)
+	if err != nil {
+		return Delivery{}, err
+	}
+	return f.Wait(ctx)
+}
+
+// Producer returns the wrapped producer
+func (t *TypedProducer[T]) Producer() *KafkaProducer {
+	return t.producer
+}
+
+func (t *TypedProducer[T]) Close() error {
+	return t.producer.Close()
+}
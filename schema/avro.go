@@ -0,0 +1,124 @@
+package schema
+
+import (
+	j "encoding/json"
+	"io"
+	"sync"
+
+	"github.com/linkedin/goavro/v2"
+	"github.com/pkg/errors"
+)
+
+// AvroCodec encodes T by its JSON form, so the usual json tags map struct fields to the record fields.
+// map[string]interface{} values are passed to goavro as native data. Unions follow goavro's textual form
+type AvroCodec[T any] struct {
+	serde
+	codec *goavro.Codec
+
+	mu sync.RWMutex
+	// writer schemas of consumed messages
+	writers map[int]*goavro.Codec
+}
+
+func NewAvroCodec[T any](registry *Registry, subject, schema string, opts ...SerdeOption) (*AvroCodec[T], error) {
+	codec, err := goavro.NewCodec(schema)
+	if err != nil {
+		return nil, errors.Wrap(err, "[kafka] invalid avro schema")
+	}
+	return &AvroCodec[T]{
+		serde: serde{
+			registry: registry,
+			subject:  subject,
+			schema:   Schema{Type: Avro, Definition: schema},
+			options:  newSerdeOptions(opts),
+		},
+		codec:   codec,
+		writers: map[int]*goavro.Codec{},
+	}, nil
+}
+
+func (c *AvroCodec[T]) Encode(v T, wr io.Writer) error {
+	id, err := c.schemaID()
+	if err != nil {
+		return err
+	}
+
+	native, ok := any(v).(map[string]interface{})
+	if !ok {
+		textual, err := j.Marshal(v)
+		if err != nil {
+			return err
+		}
+		n, _, err := c.codec.NativeFromTextual(textual)
+		if err != nil {
+			return errors.Wrap(err, "[kafka] value doesn't match avro schema")
+		}
+		native, _ = n.(map[string]interface{})
+	}
+
+	data, err := c.codec.BinaryFromNative(nil, native)
+	if err != nil {
+		return errors.Wrap(err, "[kafka] can't encode avro")
+	}
+	if err := writeHeader(wr, id); err != nil {
+		return err
+	}
+	_, err = wr.Write(data)
+	return err
+}
+
+// Decode reads the value with the schema it was written with
+func (c *AvroCodec[T]) Decode(data []byte) (T, error) {
+	var v T
+	id, payload, err := parseHeader(data)
+	if err != nil {
+		return v, err
+	}
+	writer, err := c.writer(id)
+	if err != nil {
+		return v, err
+	}
+
+	native, _, err := writer.NativeFromBinary(payload)
+	if err != nil {
+		return v, errors.Wrap(err, "[kafka] can't decode avro")
+	}
+	if m, ok := native.(map[string]interface{}); ok {
+		if res, ok := any(m).(T); ok {
+			return res, nil
+		}
+	}
+
+	textual, err := writer.TextualFromNative(nil, native)
+	if err != nil {
+		return v, errors.Wrap(err, "[kafka] can't decode avro")
+	}
+	err = j.Unmarshal(textual, &v)
+	return v, err
+}
+
+func (c *AvroCodec[T]) writer(id int) (*goavro.Codec, error) {
+	c.mu.RLock()
+	codec, ok := c.writers[id]
+	c.mu.RUnlock()
+	if ok {
+		return codec, nil
+	}
+
+	s, err := c.schemaByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if s.Type != Avro {
+		return nil, errors.Errorf("[kafka] schema %d is %s, not avro", id, s.Type)
+	}
+	codec, err = goavro.NewCodec(s.Definition)
+	if err != nil {
+		return nil, errors.Wrapf(err, "[kafka] invalid avro schema %d", id)
+	}
+
+	c.mu.Lock()
+	c.writers[id] = codec
+	c.mu.Unlock()
+	return codec, nil
+}
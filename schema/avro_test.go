@@ -0,0 +1,121 @@
+package schema
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+const orderSchema = `{"type":"record","name":"Order","fields":[
+	{"name":"id","type":"long"},
+	{"name":"customer","type":"string"}
+]}`
+
+// orderSchemaV2 adds a field, readers of the first version ignore it
+const orderSchemaV2 = `{"type":"record","name":"Order","fields":[
+	{"name":"id","type":"long"},
+	{"name":"customer","type":"string"},
+	{"name":"note","type":"string","default":""}
+]}`
+
+type order struct {
+	ID       int64  `json:"id"`
+	Customer string `json:"customer"`
+}
+
+type orderV2 struct {
+	ID       int64  `json:"id"`
+	Customer string `json:"customer"`
+	Note     string `json:"note"`
+}
+
+func TestAvroRoundTrip(t *testing.T) {
+	registry, _ := newTestRegistry(t)
+	codec, err := NewAvroCodec[order](registry, "orders-value", orderSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := codec.Encode(order{ID: 7, Customer: "ann"}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	id, _, err := parseHeader(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if registered, _ := registry.Lookup(context.Background(), "orders-value", Schema{Type: Avro, Definition: orderSchema}); registered != id {
+		t.Fatalf("header id %d, registered %d", id, registered)
+	}
+
+	got, err := codec.Decode(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != (order{ID: 7, Customer: "ann"}) {
+		t.Fatalf("got %+v", got)
+	}
+
+	native, err := NewAvroCodec[map[string]interface{}](registry, "orders-value", orderSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := native.Decode(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m["id"] != int64(7) || m["customer"] != "ann" {
+		t.Fatalf("got %v", m)
+	}
+}
+
+func TestAvroWriterSchema(t *testing.T) {
+	registry, _ := newTestRegistry(t)
+	writer, err := NewAvroCodec[orderV2](registry, "orders-value", orderSchemaV2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := NewAvroCodec[order](registry, "orders-value", orderSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := writer.Encode(orderV2{ID: 1, Customer: "bob", Note: "fragile"}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	got, err := reader.Decode(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != (order{ID: 1, Customer: "bob"}) {
+		t.Fatalf("got %+v", got)
+	}
+}
+
+func TestAvroErrors(t *testing.T) {
+	registry, _ := newTestRegistry(t)
+	if _, err := NewAvroCodec[order](registry, "orders-value", `{"type":"record"}`); err == nil {
+		t.Fatal("invalid schema accepted")
+	}
+
+	codec, err := NewAvroCodec[order](registry, "orders-value", orderSchema, AutoRegister(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := codec.Encode(order{ID: 1}, &bytes.Buffer{}); err == nil {
+		t.Fatal("encoded with an unregistered schema")
+	}
+
+	jsonCodec, err := NewJSONSchemaCodec[order](registry, "other-value", `{"type":"object"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := jsonCodec.Encode(order{ID: 1}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := codec.Decode(buf.Bytes()); err == nil {
+		t.Fatal("decoded a JSON schema message as avro")
+	}
+}
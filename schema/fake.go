@@ -0,0 +1,130 @@
+package schema
+
+import (
+	j "encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FakeRegistry is an in-memory Schema Registry for tests, serve it with httptest.NewServer
+// and pass the server URL to NewRegistry. It implements register, lookup and get-by-id only
+type FakeRegistry struct {
+	mu       sync.Mutex
+	schemas  []Schema // id is the index + 1
+	subjects map[string][]int
+}
+
+func NewFakeRegistry() *FakeRegistry {
+	return &FakeRegistry{subjects: map[string][]int{}}
+}
+
+func (f *FakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/")
+
+	switch {
+	case r.Method == http.MethodGet && len(parts) == 3 && parts[0] == "schemas" && parts[1] == "ids":
+		f.getByID(w, parts[2])
+	case r.Method == http.MethodPost && len(parts) == 3 && parts[0] == "subjects" && parts[2] == "versions":
+		f.register(w, r, parts[1])
+	case r.Method == http.MethodPost && len(parts) == 2 && parts[0] == "subjects":
+		f.lookup(w, r, parts[1])
+	default:
+		writeError(w, http.StatusNotFound, 404, "not found")
+	}
+}
+
+func (f *FakeRegistry) getByID(w http.ResponseWriter, rawID string) {
+	id, err := strconv.Atoi(rawID)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err != nil || id < 1 || id > len(f.schemas) {
+		writeError(w, http.StatusNotFound, 40403, "schema not found")
+		return
+	}
+	s := f.schemas[id-1]
+	writeJSON(w, schemaResponse{Schema: s.Definition, SchemaType: s.Type})
+}
+
+func (f *FakeRegistry) register(w http.ResponseWriter, r *http.Request, rawSubject string) {
+	subject, s, ok := readSchema(w, r, rawSubject)
+	if !ok {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id := f.idOf(s)
+	if id == 0 {
+		f.schemas = append(f.schemas, s)
+		id = len(f.schemas)
+	}
+	if !contains(f.subjects[subject], id) {
+		f.subjects[subject] = append(f.subjects[subject], id)
+	}
+	writeJSON(w, schemaResponse{ID: id})
+}
+
+func (f *FakeRegistry) lookup(w http.ResponseWriter, r *http.Request, rawSubject string) {
+	subject, s, ok := readSchema(w, r, rawSubject)
+	if !ok {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id := f.idOf(s)
+	if id == 0 || !contains(f.subjects[subject], id) {
+		writeError(w, http.StatusNotFound, 40403, "schema not found")
+		return
+	}
+	writeJSON(w, schemaResponse{ID: id, Schema: s.Definition, SchemaType: s.Type})
+}
+
+func (f *FakeRegistry) idOf(s Schema) int {
+	for i, known := range f.schemas {
+		if known == s {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+func readSchema(w http.ResponseWriter, r *http.Request, rawSubject string) (string, Schema, bool) {
+	subject, err := url.PathUnescape(rawSubject)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, 400, err.Error())
+		return "", Schema{}, false
+	}
+	var req schemaRequest
+	if err := j.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, 42201, err.Error())
+		return "", Schema{}, false
+	}
+	if req.SchemaType == "" {
+		req.SchemaType = Avro
+	}
+	return subject, Schema{Type: req.SchemaType, Definition: req.Schema}, true
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", contentType)
+	_ = j.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status, code int, msg string) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	_ = j.NewEncoder(w).Encode(errorResponse{ErrorCode: code, Message: msg})
+}
+
+func contains(ids []int, id int) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
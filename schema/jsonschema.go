@@ -0,0 +1,72 @@
+package schema
+
+import (
+	"bytes"
+	j "encoding/json"
+	"io"
+	"net/url"
+
+	"github.com/pkg/errors"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// JSONSchemaCodec encodes T with encoding/json and validates it against the schema, see Validate option
+type JSONSchemaCodec[T any] struct {
+	serde
+	validator *jsonschema.Schema
+}
+
+func NewJSONSchemaCodec[T any](registry *Registry, subject, schema string, opts ...SerdeOption) (*JSONSchemaCodec[T], error) {
+	validator, err := jsonschema.CompileString("mem:///"+url.PathEscape(subject)+".json", schema)
+	if err != nil {
+		return nil, errors.Wrap(err, "[kafka] invalid json schema")
+	}
+	return &JSONSchemaCodec[T]{
+		serde: serde{
+			registry: registry,
+			subject:  subject,
+			schema:   Schema{Type: JSON, Definition: schema},
+			options:  newSerdeOptions(opts),
+		},
+		validator: validator,
+	}, nil
+}
+
+func (c *JSONSchemaCodec[T]) Encode(v T, wr io.Writer) error {
+	id, err := c.schemaID()
+	if err != nil {
+		return err
+	}
+	data, err := j.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if c.options.validate {
+		var doc interface{}
+		dec := j.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err := dec.Decode(&doc); err != nil {
+			return err
+		}
+		if err := c.validator.Validate(doc); err != nil {
+			return errors.Wrap(err, "[kafka] value doesn't match json schema")
+		}
+	}
+
+	if err := writeHeader(wr, id); err != nil {
+		return err
+	}
+	_, err = wr.Write(data)
+	return err
+}
+
+func (c *JSONSchemaCodec[T]) Decode(data []byte) (T, error) {
+	var v T
+	_, payload, err := parseHeader(data)
+	if err != nil {
+		return v, err
+	}
+	err = j.Unmarshal(payload, &v)
+	return v, err
+}
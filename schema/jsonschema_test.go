@@ -0,0 +1,68 @@
+package schema
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+const userSchema = `{"type":"object","properties":{"name":{"type":"string","minLength":1},"age":{"type":"integer"}},"required":["name"]}`
+
+type user struct {
+	Name string `json:"name"`
+	Age  int    `json:"age"`
+}
+
+func TestJSONSchemaRoundTrip(t *testing.T) {
+	registry, _ := newTestRegistry(t)
+	codec, err := NewJSONSchemaCodec[user](registry, "users-value", userSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := codec.Encode(user{Name: "ann", Age: 30}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	id, payload, err := parseHeader(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, err := registry.SchemaByID(context.Background(), id); err != nil || s.Type != JSON {
+		t.Fatalf("registered schema %+v, %v", s, err)
+	}
+	if string(payload) != `{"name":"ann","age":30}` {
+		t.Fatalf("got payload %s", payload)
+	}
+
+	got, err := codec.Decode(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != (user{Name: "ann", Age: 30}) {
+		t.Fatalf("got %+v", got)
+	}
+}
+
+func TestJSONSchemaValidate(t *testing.T) {
+	registry, _ := newTestRegistry(t)
+	codec, err := NewJSONSchemaCodec[user](registry, "users-value", userSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := codec.Encode(user{}, &bytes.Buffer{}); err == nil {
+		t.Fatal("invalid value encoded")
+	}
+
+	lax, err := NewJSONSchemaCodec[user](registry, "users-value", userSchema, Validate(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lax.Encode(user{}, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewJSONSchemaCodec[user](registry, "users-value", `{"type":1}`); err == nil {
+		t.Fatal("invalid schema accepted")
+	}
+}
@@ -0,0 +1,103 @@
+package schema
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// ProtoCodec encodes protobuf messages, schema is the .proto file T is defined in.
+// Message indexes of T within the file follow the schema id as the wire format requires
+type ProtoCodec[T proto.Message] struct {
+	serde
+	newFn   func() T
+	indexes []byte
+}
+
+func NewProtoCodec[T proto.Message](registry *Registry, subject, schema string, newFn func() T, opts ...SerdeOption) (*ProtoCodec[T], error) {
+	if newFn == nil {
+		return nil, errors.New("[kafka] protobuf message constructor is not set")
+	}
+	return &ProtoCodec[T]{
+		serde: serde{
+			registry: registry,
+			subject:  subject,
+			schema:   Schema{Type: Protobuf, Definition: schema},
+			options:  newSerdeOptions(opts),
+		},
+		newFn:   newFn,
+		indexes: messageIndexes(newFn().ProtoReflect().Descriptor()),
+	}, nil
+}
+
+func (c *ProtoCodec[T]) Encode(v T, wr io.Writer) error {
+	id, err := c.schemaID()
+	if err != nil {
+		return err
+	}
+	data, err := proto.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "[kafka] can't encode protobuf")
+	}
+
+	if err := writeHeader(wr, id); err != nil {
+		return err
+	}
+	if _, err := wr.Write(c.indexes); err != nil {
+		return err
+	}
+	_, err = wr.Write(data)
+	return err
+}
+
+func (c *ProtoCodec[T]) Decode(data []byte) (T, error) {
+	v := c.newFn()
+	_, payload, err := parseHeader(data)
+	if err != nil {
+		return v, err
+	}
+	payload, err = skipMessageIndexes(payload)
+	if err != nil {
+		return v, err
+	}
+	return v, proto.Unmarshal(payload, v)
+}
+
+// messageIndexes is the path of the message in its file as zigzag varints: count, then indexes.
+// The first top-level message ([0]) is written as a single 0
+func messageIndexes(desc protoreflect.MessageDescriptor) []byte {
+	var path []int
+	for d := protoreflect.Descriptor(desc); d != nil; d = d.Parent() {
+		if _, ok := d.(protoreflect.MessageDescriptor); !ok {
+			break
+		}
+		path = append([]int{d.Index()}, path...)
+	}
+
+	if len(path) == 1 && path[0] == 0 {
+		return []byte{0}
+	}
+	buf := binary.AppendVarint(nil, int64(len(path)))
+	for _, i := range path {
+		buf = binary.AppendVarint(buf, int64(i))
+	}
+	return buf
+}
+
+func skipMessageIndexes(data []byte) ([]byte, error) {
+	count, n := binary.Varint(data)
+	if n <= 0 || count < 0 {
+		return nil, errors.New("[kafka] invalid protobuf message indexes")
+	}
+	data = data[n:]
+	for i := int64(0); i < count; i++ {
+		if _, n = binary.Varint(data); n <= 0 {
+			return nil, errors.New("[kafka] invalid protobuf message indexes")
+		}
+		data = data[n:]
+	}
+	return data, nil
+}
@@ -0,0 +1,77 @@
+package schema
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// descriptor.proto is used as the schema file: FileDescriptorSet is its first message,
+// DescriptorProto the third one and ExtensionRange the first message nested in it.
+// The registry doesn't parse schemas, so a stub of the file is enough
+const descriptorProto = `syntax = "proto2"; package google.protobuf; message FileDescriptorSet {}`
+
+func TestMessageIndexes(t *testing.T) {
+	for _, tc := range []struct {
+		msg  proto.Message
+		want []byte
+	}{
+		{&descriptorpb.FileDescriptorSet{}, []byte{0}},
+		// zigzag varints: count 1, index 2
+		{&descriptorpb.DescriptorProto{}, []byte{2, 4}},
+		// count 2, indexes 2 and 0
+		{&descriptorpb.DescriptorProto_ExtensionRange{}, []byte{4, 4, 0}},
+	} {
+		got := messageIndexes(tc.msg.ProtoReflect().Descriptor())
+		if !bytes.Equal(got, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.msg.ProtoReflect().Descriptor().FullName(), got, tc.want)
+		}
+		rest, err := skipMessageIndexes(append(got, 'x'))
+		if err != nil || string(rest) != "x" {
+			t.Errorf("%s: skipped to %q, %v", tc.msg.ProtoReflect().Descriptor().FullName(), rest, err)
+		}
+	}
+
+	if _, err := skipMessageIndexes([]byte{4, 4}); err == nil {
+		t.Error("truncated indexes skipped")
+	}
+}
+
+func TestProtoRoundTrip(t *testing.T) {
+	registry, _ := newTestRegistry(t)
+	codec, err := NewProtoCodec(registry, "ranges-value", descriptorProto, func() *descriptorpb.DescriptorProto_ExtensionRange {
+		return &descriptorpb.DescriptorProto_ExtensionRange{}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in := &descriptorpb.DescriptorProto_ExtensionRange{Start: proto.Int32(10), End: proto.Int32(20)}
+	var buf bytes.Buffer
+	if err := codec.Encode(in, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	id, payload, err := parseHeader(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := registry.SchemaByID(context.Background(), id)
+	if err != nil || s.Type != Protobuf {
+		t.Fatalf("registered schema %+v, %v", s, err)
+	}
+	if !bytes.HasPrefix(payload, []byte{4, 4, 0}) {
+		t.Fatalf("payload doesn't start with the message indexes: %v", payload)
+	}
+
+	out, err := codec.Decode(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(in, out) {
+		t.Fatalf("got %v, want %v", out, in)
+	}
+}
@@ -0,0 +1,199 @@
+// Package schema implements Confluent Schema Registry aware serializers for Avro, Protobuf and JSON Schema.
+// Payloads use the Confluent wire format: magic byte 0, 4-byte big-endian schema id, then the encoded value.
+// Codecs implement producer.Codec, so they plug into producer.NewTyped/producer.Encoder and, via Builder,
+// into consumer.BuilderFn.
+package schema
+
+import (
+	"bytes"
+	"context"
+	j "encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type Type string
+
+const (
+	Avro     Type = "AVRO"
+	Protobuf Type = "PROTOBUF"
+	JSON     Type = "JSON"
+)
+
+const contentType = "application/vnd.schemaregistry.v1+json"
+
+type Schema struct {
+	Type       Type
+	Definition string
+}
+
+// Registry is a Schema Registry HTTP API client, schemas and ids are cached, they are immutable in the registry
+type Registry struct {
+	url      string
+	client   *http.Client
+	user     string
+	password string
+
+	mu        sync.RWMutex
+	byID      map[int]Schema
+	bySubject map[subjectKey]int
+}
+
+type subjectKey struct {
+	subject string
+	schema  Schema
+}
+
+type RegistryOption func(*Registry)
+
+func BasicAuth(user, password string) RegistryOption {
+	return func(r *Registry) {
+		r.user = user
+		r.password = password
+	}
+}
+
+func HTTPClient(client *http.Client) RegistryOption {
+	return func(r *Registry) {
+		r.client = client
+	}
+}
+
+func NewRegistry(baseURL string, opts ...RegistryOption) *Registry {
+	r := &Registry{
+		url:       strings.TrimRight(baseURL, "/"),
+		client:    &http.Client{Timeout: time.Second * 10},
+		byID:      map[int]Schema{},
+		bySubject: map[subjectKey]int{},
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// ValueSubject is the default (topic name) subject strategy for message values
+func ValueSubject(topic string) string {
+	return topic + "-value"
+}
+
+type schemaRequest struct {
+	Schema     string `json:"schema"`
+	SchemaType Type   `json:"schemaType,omitempty"`
+}
+
+type schemaResponse struct {
+	ID         int    `json:"id"`
+	Schema     string `json:"schema"`
+	SchemaType Type   `json:"schemaType"`
+}
+
+type errorResponse struct {
+	ErrorCode int    `json:"error_code"`
+	Message   string `json:"message"`
+}
+
+// Register registers the schema under the subject (it's a no-op in the registry if it's already there)
+// and returns its id
+func (r *Registry) Register(ctx context.Context, subject string, s Schema) (int, error) {
+	return r.resolve(ctx, subject, s, "/subjects/"+url.PathEscape(subject)+"/versions")
+}
+
+// Lookup returns the id of the schema registered under the subject, it fails if the schema isn't registered
+func (r *Registry) Lookup(ctx context.Context, subject string, s Schema) (int, error) {
+	return r.resolve(ctx, subject, s, "/subjects/"+url.PathEscape(subject))
+}
+
+func (r *Registry) resolve(ctx context.Context, subject string, s Schema, path string) (int, error) {
+	key := subjectKey{subject: subject, schema: s}
+	r.mu.RLock()
+	id, ok := r.bySubject[key]
+	r.mu.RUnlock()
+	if ok {
+		return id, nil
+	}
+
+	req := schemaRequest{Schema: s.Definition}
+	// AVRO is the default type and older registries don't know the field
+	if s.Type != Avro {
+		req.SchemaType = s.Type
+	}
+
+	var resp schemaResponse
+	if err := r.do(ctx, http.MethodPost, path, req, &resp); err != nil {
+		return 0, errors.Wrapf(err, "[kafka] can't resolve schema for subject %s", subject)
+	}
+
+	r.mu.Lock()
+	r.bySubject[key] = resp.ID
+	r.byID[resp.ID] = s
+	r.mu.Unlock()
+	return resp.ID, nil
+}
+
+// SchemaByID returns the schema a message was written with
+func (r *Registry) SchemaByID(ctx context.Context, id int) (Schema, error) {
+	r.mu.RLock()
+	s, ok := r.byID[id]
+	r.mu.RUnlock()
+	if ok {
+		return s, nil
+	}
+
+	var resp schemaResponse
+	if err := r.do(ctx, http.MethodGet, fmt.Sprintf("/schemas/ids/%d", id), nil, &resp); err != nil {
+		return Schema{}, errors.Wrapf(err, "[kafka] can't get schema %d", id)
+	}
+	s = Schema{Type: resp.SchemaType, Definition: resp.Schema}
+	if s.Type == "" {
+		s.Type = Avro
+	}
+
+	r.mu.Lock()
+	r.byID[id] = s
+	r.mu.Unlock()
+	return s, nil
+}
+
+func (r *Registry) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := j.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, r.url+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", contentType)
+	if in != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if r.user != "" {
+		req.SetBasicAuth(r.user, r.password)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		var e errorResponse
+		_ = j.NewDecoder(resp.Body).Decode(&e)
+		return errors.Errorf("registry responded %d: %d %s", resp.StatusCode, e.ErrorCode, e.Message)
+	}
+	return j.NewDecoder(resp.Body).Decode(out)
+}
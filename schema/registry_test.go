@@ -0,0 +1,88 @@
+package schema
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// newTestRegistry serves a FakeRegistry, requests counts the calls it got
+func newTestRegistry(t *testing.T) (*Registry, *int64) {
+	t.Helper()
+	var requests int64
+	fake := NewFakeRegistry()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		fake.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return NewRegistry(srv.URL), &requests
+}
+
+func TestRegistry(t *testing.T) {
+	registry, requests := newTestRegistry(t)
+	ctx := context.Background()
+	s := Schema{Type: JSON, Definition: `{"type":"object"}`}
+
+	if _, err := registry.Lookup(ctx, "orders-value", s); err == nil {
+		t.Fatal("lookup of an unregistered schema succeeded")
+	}
+	id, err := registry.Register(ctx, "orders-value", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := registry.Register(ctx, "orders-value", s)
+	if err != nil || again != id {
+		t.Fatalf("second register returned %d, %v, want %d", again, err, id)
+	}
+
+	// a new client resolves the registered schema by lookup and by id
+	other := NewRegistry(registry.url)
+	if got, err := other.Lookup(ctx, "orders-value", s); err != nil || got != id {
+		t.Fatalf("lookup returned %d, %v, want %d", got, err, id)
+	}
+	got, err := other.SchemaByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != s {
+		t.Fatalf("got schema %+v, want %+v", got, s)
+	}
+
+	before := atomic.LoadInt64(requests)
+	if _, err := other.SchemaByID(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Lookup(ctx, "orders-value", s); err != nil {
+		t.Fatal(err)
+	}
+	if after := atomic.LoadInt64(requests); after != before {
+		t.Fatalf("cached schemas made %d requests", after-before)
+	}
+
+	if _, err := other.SchemaByID(ctx, id+100); err == nil {
+		t.Fatal("unknown id resolved")
+	}
+}
+
+func TestRegistryBasicAuth(t *testing.T) {
+	fake := NewFakeRegistry()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "user" || password != "secret" {
+			writeError(w, http.StatusUnauthorized, 401, "unauthorized")
+			return
+		}
+		fake.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	s := Schema{Type: Avro, Definition: `"string"`}
+	if _, err := NewRegistry(srv.URL).Register(context.Background(), "s", s); err == nil {
+		t.Fatal("registered without credentials")
+	}
+	if _, err := NewRegistry(srv.URL, BasicAuth("user", "secret")).Register(context.Background(), "s", s); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,77 @@
+package schema
+
+import (
+	"context"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"kafka/consumer"
+	"kafka/producer"
+)
+
+// requestTimeout bounds registry calls made from Encode/Decode, they have no context
+const requestTimeout = time.Second * 10
+
+type serdeOptions struct {
+	autoRegister bool
+	validate     bool
+}
+
+type SerdeOption func(*serdeOptions)
+
+// AutoRegister registers the schema on first Encode (default), otherwise it has to be registered already
+func AutoRegister(register bool) SerdeOption {
+	return func(o *serdeOptions) {
+		o.autoRegister = register
+	}
+}
+
+// Validate checks values against the schema on Encode, it's used by the JSON Schema codec (default true)
+func Validate(validate bool) SerdeOption {
+	return func(o *serdeOptions) {
+		o.validate = validate
+	}
+}
+
+func newSerdeOptions(opts []SerdeOption) serdeOptions {
+	o := serdeOptions{autoRegister: true, validate: true}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// serde resolves the id of the writer schema
+type serde struct {
+	registry *Registry
+	subject  string
+	schema   Schema
+	options  serdeOptions
+}
+
+func (s *serde) schemaID() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	if s.options.autoRegister {
+		return s.registry.Register(ctx, s.subject, s.schema)
+	}
+	return s.registry.Lookup(ctx, s.subject, s.schema)
+}
+
+func (s *serde) schemaByID(id int) (Schema, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	return s.registry.SchemaByID(ctx, id)
+}
+
+// Builder adapts a codec to consumer.BuilderFn, wrap turns the decoded value into the consumer message
+func Builder[T any](codec producer.Codec[T], wrap func(v T, msg *sarama.ConsumerMessage) consumer.KafkaMsg) func(*sarama.ConsumerMessage) (consumer.KafkaMsg, error) {
+	return func(msg *sarama.ConsumerMessage) (consumer.KafkaMsg, error) {
+		v, err := codec.Decode(msg.Value)
+		if err != nil {
+			return nil, err
+		}
+		return wrap(v, msg), nil
+	}
+}
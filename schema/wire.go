@@ -0,0 +1,32 @@
+package schema
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	magicByte  = 0
+	headerSize = 5
+)
+
+func writeHeader(wr io.Writer, id int) error {
+	var header [headerSize]byte
+	header[0] = magicByte
+	binary.BigEndian.PutUint32(header[1:], uint32(id))
+	_, err := wr.Write(header[:])
+	return err
+}
+
+// parseHeader returns the schema id and the encoded value
+func parseHeader(data []byte) (int, []byte, error) {
+	if len(data) < headerSize {
+		return 0, nil, errors.New("[kafka] message is too short for the schema registry wire format")
+	}
+	if data[0] != magicByte {
+		return 0, nil, errors.Errorf("[kafka] unknown magic byte %d", data[0])
+	}
+	return int(binary.BigEndian.Uint32(data[1:headerSize])), data[headerSize:], nil
+}
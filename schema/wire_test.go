@@ -0,0 +1,32 @@
+package schema
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWireHeader(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeHeader(&buf, 0x01020304); err != nil {
+		t.Fatal(err)
+	}
+	buf.WriteString("payload")
+	if want := []byte{0, 1, 2, 3, 4}; !bytes.Equal(buf.Bytes()[:headerSize], want) {
+		t.Fatalf("got header %v, want %v", buf.Bytes()[:headerSize], want)
+	}
+
+	id, payload, err := parseHeader(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 0x01020304 || string(payload) != "payload" {
+		t.Fatalf("got id %x payload %q", id, payload)
+	}
+
+	if _, _, err := parseHeader([]byte{0, 1, 2}); err == nil {
+		t.Error("short message parsed")
+	}
+	if _, _, err := parseHeader([]byte{1, 0, 0, 0, 1, 'x'}); err == nil {
+		t.Error("unknown magic byte parsed")
+	}
+}
@@ -0,0 +1,74 @@
+package security
+
+import (
+	"github.com/Shopify/sarama"
+	"github.com/pkg/errors"
+	"github.com/xdg-go/scram"
+)
+
+type Mechanism string
+
+const (
+	Plain       Mechanism = sarama.SASLTypePlaintext
+	ScramSHA256 Mechanism = sarama.SASLTypeSCRAMSHA256
+	ScramSHA512 Mechanism = sarama.SASLTypeSCRAMSHA512
+)
+
+// SASL describes broker authentication
+type SASL struct {
+	Mechanism Mechanism
+	User      string
+	Password  string
+}
+
+func (s SASL) apply(cfg *sarama.Config) error {
+	if s.User == "" {
+		return errors.New("[kafka] SASL user is not set")
+	}
+
+	cfg.Net.SASL.Enable = true
+	cfg.Net.SASL.Handshake = true
+	cfg.Net.SASL.User = s.User
+	cfg.Net.SASL.Password = s.Password
+
+	switch s.Mechanism {
+	case Plain, "":
+		cfg.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+	case ScramSHA256:
+		cfg.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+		cfg.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+			return &scramClient{hashGen: scram.SHA256}
+		}
+	case ScramSHA512:
+		cfg.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+		cfg.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+			return &scramClient{hashGen: scram.SHA512}
+		}
+	default:
+		return errors.Errorf("[kafka] unsupported SASL mechanism %q", s.Mechanism)
+	}
+	return nil
+}
+
+// scramClient implements sarama.SCRAMClient
+type scramClient struct {
+	hashGen scram.HashGeneratorFcn
+	conv    *scram.ClientConversation
+}
+
+func (c *scramClient) Begin(userName, password, authzID string) error {
+	client, err := c.hashGen.NewClient(userName, password, authzID)
+	if err != nil {
+		return err
+	}
+	c.conv = client.NewConversation()
+	return nil
+}
+
+func (c *scramClient) Step(challenge string) (string, error) {
+	return c.conv.Step(challenge)
+}
+
+func (c *scramClient) Done() bool {
+	return c.conv.Done()
+}
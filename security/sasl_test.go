@@ -0,0 +1,113 @@
+package security
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/xdg-go/scram"
+)
+
+func TestSASLApply(t *testing.T) {
+	for _, tc := range []struct {
+		mechanism Mechanism
+		want      string
+		scram     bool
+	}{
+		{"", sarama.SASLTypePlaintext, false},
+		{Plain, sarama.SASLTypePlaintext, false},
+		{ScramSHA256, sarama.SASLTypeSCRAMSHA256, true},
+		{ScramSHA512, sarama.SASLTypeSCRAMSHA512, true},
+	} {
+		cfg := sarama.NewConfig()
+		if err := Apply(cfg, nil, &SASL{Mechanism: tc.mechanism, User: "user", Password: "secret"}); err != nil {
+			t.Fatalf("%q: %v", tc.mechanism, err)
+		}
+		sasl := cfg.Net.SASL
+		if !sasl.Enable || !sasl.Handshake || sasl.User != "user" || sasl.Password != "secret" {
+			t.Errorf("%q: got %+v", tc.mechanism, sasl)
+		}
+		if string(sasl.Mechanism) != tc.want {
+			t.Errorf("%q: got mechanism %s, want %s", tc.mechanism, sasl.Mechanism, tc.want)
+		}
+		if (sasl.SCRAMClientGeneratorFunc != nil) != tc.scram {
+			t.Errorf("%q: SCRAM client generator set=%v", tc.mechanism, sasl.SCRAMClientGeneratorFunc != nil)
+		}
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("%q: invalid config: %v", tc.mechanism, err)
+		}
+	}
+}
+
+func TestSASLApplyErrors(t *testing.T) {
+	if err := Apply(sarama.NewConfig(), nil, &SASL{Password: "secret"}); err == nil {
+		t.Error("no error without user")
+	}
+	if err := Apply(sarama.NewConfig(), nil, &SASL{Mechanism: "GSSAPI", User: "user"}); err == nil {
+		t.Error("no error for unsupported mechanism")
+	}
+	if err := Apply(sarama.NewConfig(), &TLS{CAFile: "missing.pem"}, nil); err == nil {
+		t.Error("no error for invalid TLS")
+	}
+}
+
+func TestSCRAMClient(t *testing.T) {
+	for name, hash := range map[Mechanism]scram.HashGeneratorFcn{ScramSHA256: scram.SHA256, ScramSHA512: scram.SHA512} {
+		t.Run(string(name), func(t *testing.T) {
+			server := scramServer(t, hash, "user", "secret")
+
+			cfg := sarama.NewConfig()
+			if err := Apply(cfg, nil, &SASL{Mechanism: name, User: "user", Password: "secret"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := converse(cfg.Net.SASL.SCRAMClientGeneratorFunc(), server.NewConversation(), "secret"); err != nil {
+				t.Fatal(err)
+			}
+			if err := converse(cfg.Net.SASL.SCRAMClientGeneratorFunc(), server.NewConversation(), "wrong"); err == nil {
+				t.Fatal("wrong password is accepted")
+			}
+		})
+	}
+}
+
+// converse runs the SCRAM exchange of sarama's broker between the client and the server
+func converse(client sarama.SCRAMClient, server *scram.ServerConversation, password string) error {
+	if err := client.Begin("user", password, ""); err != nil {
+		return err
+	}
+	msg, err := client.Step("")
+	if err != nil {
+		return err
+	}
+	for !client.Done() {
+		challenge, err := server.Step(msg)
+		if err != nil {
+			return err
+		}
+		if msg, err = client.Step(challenge); err != nil {
+			return err
+		}
+	}
+	if !server.Valid() {
+		return errors.New("server conversation is not valid")
+	}
+	return nil
+}
+
+func scramServer(t *testing.T, hash scram.HashGeneratorFcn, user, password string) *scram.Server {
+	client, err := hash.NewClient(user, password, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentials := client.GetStoredCredentials(scram.KeyFactors{Salt: "salt", Iters: 4096})
+	server, err := hash.NewServer(func(name string) (scram.StoredCredentials, error) {
+		if name != user {
+			return scram.StoredCredentials{}, errors.New("unknown user " + name)
+		}
+		return credentials, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
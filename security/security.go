@@ -0,0 +1,26 @@
+// Package security applies TLS and SASL settings to sarama configs,
+// it's shared by the client and the producer so both connect the same way
+package security
+
+import (
+	"github.com/Shopify/sarama"
+)
+
+// Apply enables TLS and SASL on the config, nil leaves the part disabled
+func Apply(cfg *sarama.Config, t *TLS, s *SASL) error {
+	if t != nil {
+		tlsConfig, err := t.Config()
+		if err != nil {
+			return err
+		}
+		cfg.Net.TLS.Enable = true
+		cfg.Net.TLS.Config = tlsConfig
+	}
+
+	if s != nil {
+		if err := s.apply(cfg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
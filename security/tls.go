@@ -0,0 +1,52 @@
+package security
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// TLS describes a connection to a TLS listener, all files are PEM encoded
+type TLS struct {
+	// CAFile is a CA bundle to verify brokers, system pool is used if it's empty
+	CAFile string
+	// CertFile and KeyFile are a client certificate for mutual TLS
+	CertFile string
+	KeyFile  string
+	// ServerName overrides the name used to verify broker certificates
+	ServerName string
+	// InsecureSkipVerify disables verification of broker certificates, use it for development only
+	InsecureSkipVerify bool
+}
+
+// Config builds tls.Config from the files
+func (t TLS) Config() (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify, //nolint:gosec // opt-in for development
+	}
+
+	if t.CAFile != "" {
+		ca, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "[kafka] can't read CA file")
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, errors.Errorf("[kafka] no certificates found in %s", t.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if t.CertFile != "" || t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "[kafka] can't load client certificate")
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,66 @@
+package security
+
+import (
+	"crypto/tls"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"kafka/security/securitytest"
+)
+
+func TestTLSConfig(t *testing.T) {
+	files := securitytest.NewFiles(t)
+
+	cfg, err := TLS{CAFile: files.CA, CertFile: files.ClientCert, KeyFile: files.ClientKey, ServerName: "localhost"}.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RootCAs == nil {
+		t.Error("RootCAs is not set")
+	}
+	if len(cfg.Certificates) != 1 {
+		t.Errorf("got %d client certificates, want 1", len(cfg.Certificates))
+	}
+	if cfg.ServerName != "localhost" || cfg.MinVersion != tls.VersionTLS12 {
+		t.Errorf("got ServerName=%q MinVersion=%x", cfg.ServerName, cfg.MinVersion)
+	}
+
+	// mutual TLS handshake with a listener requiring client certificates
+	l := securitytest.Listener(t, files)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_ = conn.(*tls.Conn).Handshake()
+	}()
+	conn, err := tls.Dial("tcp", l.Addr().String(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := conn.Handshake(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTLSConfigErrors(t *testing.T) {
+	files := securitytest.NewFiles(t)
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	if err := os.WriteFile(empty, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, cfg := range map[string]TLS{
+		"missing CA":       {CAFile: filepath.Join(t.TempDir(), "missing.pem")},
+		"CA without cert":  {CAFile: empty},
+		"cert without key": {CertFile: files.ClientCert},
+		"mismatched key":   {CertFile: files.ClientCert, KeyFile: files.ServerKey},
+	} {
+		if _, err := cfg.Config(); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}